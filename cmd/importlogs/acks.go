@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/klauspost/InterviewAssignment/traffic"
+)
+
+// ackTracker tracks the lines of a file that have been sent to
+// an AckStore, and finds the offset of the last line, where all
+// previous lines have been stored.
+//
+// Line numbers are used as sequence numbers.
+type ackTracker struct {
+	mu      sync.Mutex
+	pending []pendingLine // Lines that have not been committed, in order.
+	offset  int64         // Offset after the last committed line.
+	lines   int64         // Number of committed lines.
+	stored  int64         // Number of stored requests.
+	failed  []traffic.StoreFailure
+
+	// If set, failed requests are passed to report and committed,
+	// instead of stopping the commit. Used by imports that cannot
+	// be resumed, like the messages received by a listener.
+	report   func(traffic.StoreFailure)
+	reported int64 // Number of failed requests passed to report.
+}
+
+// pendingLine is a line that has been read,
+// but not yet been committed.
+type pendingLine struct {
+	seq    int64 // Line number.
+	offset int64 // Offset after the line.
+	done   bool  // The line has been stored or skipped.
+}
+
+// reset will start tracking at the offset and line number.
+// There must be no pending lines.
+func (a *ackTracker) reset(offset, lines int64) {
+	a.mu.Lock()
+	a.pending = a.pending[:0]
+	a.offset, a.lines = offset, lines
+	a.mu.Unlock()
+}
+
+// sent must be called before a line is sent to the store.
+func (a *ackTracker) sent(seq, offset int64) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	a.pending = append(a.pending, pendingLine{seq: seq, offset: offset})
+	a.mu.Unlock()
+}
+
+// skipped must be called when a line is read,
+// but no request is sent to the store.
+func (a *ackTracker) skipped(seq, offset int64) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	if len(a.pending) == 0 {
+		a.offset, a.lines = offset, seq
+	} else {
+		a.pending = append(a.pending, pendingLine{seq: seq, offset: offset, done: true})
+	}
+	a.mu.Unlock()
+}
+
+// Ack will mark stored lines as done, and commit all lines
+// up to the first line that is pending or failed.
+func (a *ackTracker) Ack(ack traffic.Ack) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.stored += int64(len(ack.Stored))
+	for _, seq := range ack.Stored {
+		a.done(seq)
+	}
+	if a.report == nil {
+		a.failed = append(a.failed, ack.Failed...)
+	} else {
+		for _, f := range ack.Failed {
+			a.report(f)
+			a.reported++
+			a.done(f.Seq)
+		}
+	}
+	for len(a.pending) > 0 && a.pending[0].done {
+		a.offset, a.lines = a.pending[0].offset, a.pending[0].seq
+		a.pending = a.pending[1:]
+	}
+}
+
+// done marks a pending line as done.
+func (a *ackTracker) done(seq int64) {
+	i := sort.Search(len(a.pending), func(i int) bool { return a.pending[i].seq >= seq })
+	if i < len(a.pending) && a.pending[i].seq == seq {
+		a.pending[i].done = true
+	}
+}
+
+// committed returns the offset after the last line, where all
+// previous lines have been stored, and the number of lines before it.
+func (a *ackTracker) committed() (offset, lines int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.offset, a.lines
+}
+
+// counts returns the number of stored and failed requests.
+func (a *ackTracker) counts() (stored, failed int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.stored, int64(len(a.failed)) + a.reported
+}
+
+// Err returns an error describing the first request
+// that could not be stored.
+func (a *ackTracker) Err() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.failed) == 0 {
+		return nil
+	}
+	f := a.failed[0]
+	return fmt.Errorf("line %d was not stored: %s", f.Seq, f.Reason)
+}
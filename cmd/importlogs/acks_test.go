@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/klauspost/InterviewAssignment/traffic"
+)
+
+// Tests that lines are only committed when all
+// previous lines have been stored.
+func TestAckTracker(t *testing.T) {
+	var a ackTracker
+	a.reset(100, 10)
+	a.sent(11, 110)
+	a.skipped(12, 120)
+	a.sent(13, 130)
+	a.sent(14, 140)
+	a.sent(15, 150)
+
+	check := func(offset, lines int64) {
+		gotOffset, gotLines := a.committed()
+		if gotOffset != offset || gotLines != lines {
+			t.Fatalf("expected commit at %d after line %d, got %d after line %d", offset, lines, gotOffset, gotLines)
+		}
+	}
+	check(100, 10)
+
+	// Line 13 is stored, but 11 is still pending.
+	a.Ack(traffic.Ack{Stored: []int64{13}})
+	check(100, 10)
+
+	// Line 11 is stored, so 11-13 are committed.
+	a.Ack(traffic.Ack{Stored: []int64{11}})
+	check(130, 13)
+
+	// Line 14 failed, so nothing after it can be committed.
+	a.Ack(traffic.Ack{Stored: []int64{15}, Failed: []traffic.StoreFailure{{Seq: 14, Reason: "rejected"}}})
+	check(130, 13)
+	if a.Err() == nil {
+		t.Fatal("expected error from failed request")
+	}
+	stored, failed := a.counts()
+	if stored != 3 || failed != 1 {
+		t.Fatalf("expected 3 stored and 1 failed, got %d and %d", stored, failed)
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Escaping of values in Apache logs.
+// '"' and '\' are written as \" and \\, and control characters as \xHH.
+const escapeApache = "apache"
+
+// apacheFields maps Apache format specifiers without
+// an argument to field names.
+// See https://httpd.apache.org/docs/2.4/mod/mod_log_config.html#formats
+var apacheFields = map[byte]string{
+	'a': "remote_addr",
+	'h': "remote_addr",
+	'l': "remote_logname",
+	'u': "remote_user",
+	'r': "request",
+	's': "status",
+	'b': "size",
+	'B': "size",
+	'O': "bytes_sent",
+	'I': "bytes_received",
+	'D': "request_time_us",
+	'T': "request_time",
+	'v': "server_name",
+	'V': "server_name",
+	'p': "server_port",
+	'm': "method",
+	'U': "uri",
+	'H': "protocol",
+	'q': "query_string",
+	'A': "server_addr",
+	'f': "request_filename",
+	'k': "keepalive_requests",
+	'L': "log_id",
+	'P': "pid",
+	'R': "handler",
+	'X': "connection_status",
+}
+
+// strftimeLayouts maps strftime conversions to Go time layouts.
+var strftimeLayouts = map[byte]string{
+	'a': "Mon",
+	'A': "Monday",
+	'b': "Jan",
+	'h': "Jan",
+	'B': "January",
+	'd': "02",
+	'e': "_2",
+	'm': "01",
+	'y': "06",
+	'Y': "2006",
+	'H': "15",
+	'I': "03",
+	'M': "04",
+	'S': "05",
+	'p': "PM",
+	'z': "-0700",
+	'Z': "MST",
+	'j': "002",
+	'T': "15:04:05",
+	'D': "01/02/06",
+	'F': "2006-01-02",
+	'R': "15:04",
+	'%': "%",
+}
+
+// applyApacheFormat will set the -format and -timeformat flags from an
+// Apache LogFormat string. An explicit -timeformat overrides the
+// generated time format.
+func applyApacheFormat(s string) error {
+	set := flagsSet()
+	if set["format"] || set["preset"] || set["nginx-conf"] {
+		return fmt.Errorf("-format, -preset and -nginx-conf cannot be used with -apache-format")
+	}
+	f, layout, err := apacheLogFormat(s)
+	if err != nil {
+		return fmt.Errorf("-apache-format: %v", err)
+	}
+	*format, formatEscape = f, escapeApache
+	if layout != "" && !set["timeformat"] {
+		*timeFormat = layout
+	}
+	return nil
+}
+
+// apacheLogFormat translates an Apache format string to a log format
+// and returns the time layout of the time fields.
+// A complete LogFormat directive is also accepted.
+//
+// Header fields are named as nginx does, so %{User-Agent}i is
+// $http_user_agent. Time specifiers separated only by text, like
+// "%{%d/%b/%Y %T}t.%{msec_frac}t", are combined to a single time field.
+func apacheLogFormat(s string) (format, layout string, err error) {
+	if strings.HasPrefix(s, "LogFormat") {
+		tokens, err := nginxTokens([]byte(s))
+		if err != nil {
+			return "", "", err
+		}
+		if len(tokens) < 2 {
+			return "", "", fmt.Errorf("no format in LogFormat directive")
+		}
+		s = tokens[1].s
+	}
+
+	var out []byte
+	used := make(map[string]int)
+	add := func(name string) {
+		// Names must be unique. Later fields with the same name are ignored.
+		used[name]++
+		if n := used[name]; n > 1 {
+			name = fmt.Sprintf("%s_%d", name, n)
+		}
+		out = append(out, '$')
+		out = append(out, name...)
+	}
+	timeEnd := -1 // Length of out after the time field, while it can be extended.
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			out = append(out, s[i])
+			continue
+		}
+		// Skip status conditions and < > modifiers, for example %!200,304{Referer}i or %>s.
+		i++
+		for i < len(s) && strings.IndexByte("<>!,0123456789", s[i]) >= 0 {
+			i++
+		}
+		var arg string
+		if i < len(s) && s[i] == '{' {
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return "", "", fmt.Errorf("unterminated %%{ at %d", i)
+			}
+			arg = s[i+1 : i+end]
+			i += end + 1
+		}
+		if i >= len(s) {
+			return "", "", fmt.Errorf("incomplete specifier at end of format")
+		}
+		c := s[i]
+		if c == '%' {
+			out = append(out, '%')
+			continue
+		}
+		if c != 't' {
+			timeEnd = -1
+		}
+		switch c {
+		case 't':
+			arg = strings.TrimPrefix(strings.TrimPrefix(arg, "begin:"), "end:")
+			switch arg {
+			case "":
+				if layout != "" {
+					return "", "", fmt.Errorf("only one time field is supported")
+				}
+				out = append(out, '[')
+				add("time_local")
+				out = append(out, ']')
+				layout, timeEnd = apacheTime, -1
+				continue
+			case "sec":
+				add("msec")
+				timeEnd = -1
+				continue
+			case "msec":
+				add("time_msec")
+				timeEnd = -1
+				continue
+			case "usec":
+				add("time_usec")
+				timeEnd = -1
+				continue
+			}
+			part, err := strftimeLayout(arg)
+			if err != nil {
+				return "", "", err
+			}
+			switch {
+			case timeEnd >= 0:
+				// Extend the time field with the text since it.
+				layout += string(out[timeEnd:]) + part
+				out = out[:timeEnd]
+			case layout != "":
+				return "", "", fmt.Errorf("only one time field is supported")
+			default:
+				add("time_local")
+				layout = part
+			}
+			timeEnd = len(out)
+		case 'i':
+			add("http_" + headerName(arg))
+		case 'o':
+			add("sent_http_" + headerName(arg))
+		case 'C':
+			add("cookie_" + headerName(arg))
+		case 'e':
+			add("env_" + headerName(arg))
+		case 'n':
+			add("note_" + headerName(arg))
+		case 'T':
+			switch arg {
+			case "", "s":
+				add("request_time")
+			case "ms":
+				add("request_time_ms")
+			case "us":
+				add("request_time_us")
+			default:
+				return "", "", fmt.Errorf("unknown unit %%{%s}T", arg)
+			}
+		default:
+			name, ok := apacheFields[c]
+			if !ok {
+				return "", "", fmt.Errorf("unknown specifier %%%c", c)
+			}
+			add(name)
+		}
+	}
+	return string(out), layout, nil
+}
+
+// headerName returns the name of a header as a field name,
+// for example "User-Agent" is "user_agent".
+func headerName(s string) string {
+	return strings.Replace(strings.ToLower(s), "-", "_", -1)
+}
+
+// strftimeLayout converts a strftime format to a Go time layout.
+// msec_frac and usec_frac are converted to fractional seconds.
+func strftimeLayout(s string) (string, error) {
+	switch s {
+	case "msec_frac":
+		return "000", nil
+	case "usec_frac":
+		return "000000", nil
+	}
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			b = append(b, s[i])
+			continue
+		}
+		i++
+		if i == len(s) {
+			return "", fmt.Errorf("incomplete time format %q", s)
+		}
+		l, ok := strftimeLayouts[s[i]]
+		if !ok {
+			return "", fmt.Errorf("unsupported time conversion %s in %q", strconv.Quote(s[i-1:i+1]), s)
+		}
+		b = append(b, l...)
+	}
+	return string(b), nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestApacheLogFormat(t *testing.T) {
+	tests := []struct {
+		in, format, layout string
+	}{
+		{
+			in:     `%h %l %u %t "%r" %>s %b`,
+			format: `$remote_addr $remote_logname $remote_user [$time_local] "$request" $status $size`,
+			layout: apacheTime,
+		},
+		{
+			in:     `LogFormat "%v:%p %h %l %u %t \"%r\" %>s %O \"%{Referer}i\" \"%{User-Agent}i\" %D" vhost_combined`,
+			format: `$server_name:$server_port $remote_addr $remote_logname $remote_user [$time_local] "$request" $status $bytes_sent "$http_referer" "$http_user_agent" $request_time_us`,
+			layout: apacheTime,
+		},
+		{
+			in:     `%a [%{%d/%b/%Y %T}t.%{msec_frac}t %{%z}t] "%r" %!200,304{X-Forwarded-For}i %{ms}T %%`,
+			format: `$remote_addr [$time_local] "$request" $http_x_forwarded_for $request_time_ms %`,
+			layout: `02/Jan/2006 15:04:05.000 -0700`,
+		},
+		{
+			in:     `%h %h %{end:msec}t %T`,
+			format: `$remote_addr $remote_addr_2 $time_msec $request_time`,
+		},
+	}
+	for _, test := range tests {
+		format, layout, err := apacheLogFormat(test.in)
+		if err != nil {
+			t.Errorf("%s: %v", test.in, err)
+			continue
+		}
+		if format != test.format || layout != test.layout {
+			t.Errorf("%s: got format %q, layout %q", test.in, format, layout)
+		}
+	}
+
+	for _, in := range []string{`%h %Q`, `%{%d %Q}t`, `%{Referer`, `%h %`, `%t %t`} {
+		_, _, err := apacheLogFormat(in)
+		if err == nil {
+			t.Errorf("%s: expected error", in)
+		}
+	}
+}
+
+// Tests parsing a line written by Apache.
+func TestApacheParse(t *testing.T) {
+	defer func(tf string) {
+		*timeFormat = tf
+	}(*timeFormat)
+
+	format, layout, err := apacheLogFormat(`%h %l %u [%{%d/%b/%Y %T}t.%{msec_frac}t %{%z}t] "%r" %>s %b "%{Referer}i" "%{User-Agent}i" %D`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	*timeFormat = layout
+	line := `10.0.0.1 - bob [01/Jul/1995 00:00:01.250 -0400] "GET /a\"b HTTP/1.1" 200 - "-" "say \"hi\"\\" 1500`
+	rec, err := mustParser(t, format, escapeApache).ParseString(line)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := parseEntry(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Unix(804571201, 250e6); !req.ServerTime.Equal(want) {
+		t.Errorf("expected time %v, got %v", want, req.ServerTime)
+	}
+	if req.URI != `/a"b` || req.RemoteUser != "bob" || req.UserAgent != `say "hi"\` || req.Referer != "" {
+		t.Errorf("unexpected request %+v", req)
+	}
+	if req.RequestTime != 0.0015 {
+		t.Errorf("expected request time 0.0015, got %v", req.RequestTime)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/satyrius/gonx"
+)
+
+// albFields are the fields of Application Load Balancer logs, in order.
+// Lines may have more fields than listed.
+// See https://docs.aws.amazon.com/elasticloadbalancing/latest/application/load-balancer-access-logs.html
+var albFields = []string{
+	"type", "time_iso8601", "elb", "client", "target",
+	"request_processing_time", "target_processing_time", "response_processing_time",
+	"status", "upstream_status", "bytes_received", "bytes_sent",
+	"request", "http_user_agent", "ssl_cipher", "ssl_protocol",
+	"target_group_arn", "request_id", "server_name", "chosen_cert_arn",
+	"matched_rule_priority", "request_creation_time", "actions_executed",
+	"redirect_url", "error_reason", "target_list", "target_status_list",
+}
+
+// elbFields are the fields of Classic Load Balancer logs, in order.
+// See https://docs.aws.amazon.com/elasticloadbalancing/latest/classic/access-log-collection.html
+var elbFields = []string{
+	"time_iso8601", "elb", "client", "target",
+	"request_processing_time", "target_processing_time", "response_processing_time",
+	"status", "upstream_status", "bytes_received", "bytes_sent",
+	"request", "http_user_agent", "ssl_cipher", "ssl_protocol",
+}
+
+// albParser parses AWS load balancer logs.
+type albParser struct {
+	fields []string
+	min    int // Minimum number of fields.
+}
+
+// newALBParser returns a parser for Application Load Balancer logs.
+func newALBParser() gonx.StringParser {
+	// Fields are added to the format over time, so lines may have
+	// more or fewer fields than listed. The first 16 are always present.
+	return &albParser{fields: albFields, min: 16}
+}
+
+// newELBParser returns a parser for Classic Load Balancer logs.
+func newELBParser() gonx.StringParser {
+	// Logs written before the user agent, TLS cipher and
+	// protocol were added have the first 12 fields.
+	return &albParser{fields: elbFields, min: 12}
+}
+
+// ParseString parses a load balancer log line.
+func (p *albParser) ParseString(line string) (*gonx.Entry, error) {
+	values, err := w3cSplit(line)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) < p.min {
+		return nil, fmt.Errorf("line has %d fields, expected at least %d", len(values), p.min)
+	}
+	entry := gonx.NewEmptyEntry()
+	for i, v := range values {
+		if i >= len(p.fields) {
+			break
+		}
+		entry.SetField(p.fields[i], v)
+	}
+
+	// The request line has the absolute URI, for example
+	// "GET http://www.example.com:80/ HTTP/1.1". The host is
+	// used if the virtual host is not logged.
+	if r, _ := entry.Field("request"); r != "" {
+		_, uri, _, _ := parseRequestLine(r)
+		if host, path, ok := splitAbsoluteURI(uri); ok {
+			entry.SetField("request", strings.Replace(r, uri, path, 1))
+			entry.SetField("host", host)
+		}
+	}
+
+	// The client and target are written as address:port.
+	if c, _ := entry.Field("client"); c != "" {
+		entry.SetField("remote_addr", hostOnly(c))
+	}
+	if t, _ := entry.Field("target"); t != "-" {
+		entry.SetField("upstream_addr", t)
+	}
+
+	// Times are -1 if the request was not sent or no response was received.
+	total := 0.0
+	for _, name := range []string{"request_processing_time", "target_processing_time", "response_processing_time"} {
+		v, _ := entry.Field(name)
+		t, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, &lineError{Kind: name, Err: err}
+		}
+		if t < 0 {
+			total = -1
+			break
+		}
+		total += t
+	}
+	if total >= 0 {
+		entry.SetField("request_time", strconv.FormatFloat(total, 'f', -1, 64))
+	}
+	if t, _ := entry.Field("target_processing_time"); t != "-1" {
+		entry.SetField("upstream_response_time", t)
+	}
+	return entry, nil
+}
+
+// hostOnly returns the host of an address with a port.
+// If there is no port, the address is returned.
+func hostOnly(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// cloudFrontFields maps CloudFront fields to field names,
+// where they differ from W3C fields.
+// See https://docs.aws.amazon.com/AmazonCloudFront/latest/DeveloperGuide/AccessLogs.html
+var cloudFrontFields = map[string]string{
+	"x-edge-location":     "edge_location",
+	"x-edge-request-id":   "request_id",
+	"x-host-header":       "server_name",
+	"x-forwarded-for":     "http_x_forwarded_for",
+	"ssl-protocol":        "ssl_protocol",
+	"ssl-cipher":          "ssl_cipher",
+	"cs-protocol":         "scheme",
+	"cs-protocol-version": "protocol",
+	"c-port":              "remote_port",
+}
+
+// newCloudFrontParser returns a parser for CloudFront logs.
+// These are W3C logs separated by tabs, where headers are URL-encoded.
+func newCloudFrontParser() gonx.StringParser {
+	return &w3cParser{cloudFront: true}
+}
+
+// cloudFrontSplit splits a CloudFront line into values.
+func cloudFrontSplit(line string) []string {
+	return strings.Split(line, "\t")
+}
+
+// urlDecode decodes a URL-encoded value.
+// '+' is not decoded, and invalid values are returned as is.
+func urlDecode(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	u, err := url.QueryUnescape(strings.Replace(s, "+", "%2B", -1))
+	if err != nil {
+		return s
+	}
+	return u
+}
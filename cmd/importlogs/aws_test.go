@@ -0,0 +1,124 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/klauspost/InterviewAssignment/traffic"
+)
+
+// parseInput parses a line with the named input.
+func parseInput(t *testing.T, input, line string) *traffic.Request {
+	rec, err := inputs[input]().ParseString(line)
+	if err != nil {
+		t.Fatalf("%s: %v", input, err)
+	}
+	req, err := parseEntry(rec)
+	if err != nil {
+		t.Fatalf("%s: %v", input, err)
+	}
+	return req
+}
+
+func TestALB(t *testing.T) {
+	req := parseInput(t, "alb", `https 2018-07-02T22:23:00.186641Z app/my-loadbalancer/50dc6c495c0c9188 192.168.131.39:2817 10.0.0.1:80 0.086 0.048 0.037 200 502 0 57 "GET https://www.example.com:443/a?b=c HTTP/1.1" "curl/7.46.0" ECDHE-RSA-AES128-GCM-SHA256 TLSv1.2 arn:aws:elasticloadbalancing:us-east-2:123456789012:targetgroup/my-targets/73e2d6bc24d8a067 "Root=1-58337281-1d84f3d73c47ec4e58577259" "www.example.com" "arn:aws:acm:us-east-2:123456789012:certificate/12345678-1234-1234-1234-123456789012" 1 2018-07-02T22:22:48.364000Z "authenticate,forward" "-" "-" "10.0.0.1:80" "200" "-" "-"`)
+	want := traffic.Request{
+		ServerTime:     time.Date(2018, 7, 2, 22, 23, 0, 186641000, time.UTC),
+		Remote:         "192.168.131.39",
+		Method:         "GET",
+		URI:            "/a?b=c",
+		Protocol:       "HTTP/1.1",
+		StatusCode:     200,
+		Payload:        57,
+		UserAgent:      "curl/7.46.0",
+		VirtualHost:    "www.example.com",
+		RequestTime:    0.171,
+		UpstreamTime:   0.048,
+		UpstreamAddr:   "10.0.0.1:80",
+		RequestID:      "Root=1-58337281-1d84f3d73c47ec4e58577259",
+		UpstreamStatus: 502,
+		TLSProtocol:    "TLSv1.2",
+		TLSCipher:      "ECDHE-RSA-AES128-GCM-SHA256",
+	}
+	if !req.ServerTime.Equal(want.ServerTime) {
+		t.Errorf("expected time %v, got %v", want.ServerTime, req.ServerTime)
+	}
+	req.ServerTime = want.ServerTime
+	if !reflect.DeepEqual(*req, want) {
+		t.Errorf("got %+v\nwant %+v", *req, want)
+	}
+
+	// A request that was not sent to a target.
+	req = parseInput(t, "alb", `http 2018-11-30T22:23:00.186641Z app/my-loadbalancer/50dc6c495c0c9188 192.168.131.39:2817 - -1 -1 -1 460 - 34 0 "GET http://www.example.com:80/ HTTP/1.1" "curl/7.46.0" - - -`)
+	if req.StatusCode != 460 || req.UpstreamStatus != 0 || req.RequestTime != 0 || req.UpstreamTime != 0 || req.UpstreamAddr != "" {
+		t.Errorf("unexpected request %+v", *req)
+	}
+
+	// Other formats keep the absolute URI.
+	rec, err := mustParser(t, presets["combined"].format, "").ParseString(`10.0.0.1 - - [06/Oct/2016:00:17:09 +0000] "GET http://www.example.com/a HTTP/1.1" 200 612 "-" "curl/7.50"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err = parseEntry(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.URI != "http://www.example.com/a" || req.VirtualHost != "" {
+		t.Errorf("unexpected request %+v", *req)
+	}
+}
+
+func TestELB(t *testing.T) {
+	req := parseInput(t, "elb", `2015-05-13T23:39:43.945958Z my-loadbalancer 192.168.131.39:2817 10.0.0.1:80 0.000073 0.001048 0.000057 200 200 0 29 "GET http://www.example.com:80/ HTTP/1.1" "curl/7.38.0" - -`)
+	if req.Remote != "192.168.131.39" || req.URI != "/" || req.VirtualHost != "www.example.com" || req.StatusCode != 200 || req.UpstreamStatus != 200 || req.Payload != 29 || req.UpstreamTime != 0.001048 {
+		t.Errorf("unexpected request %+v", *req)
+	}
+	// A line written before the user agent and TLS fields were added.
+	req = parseInput(t, "elb", `2014-02-15T23:39:43.945958Z my-loadbalancer 192.168.131.39:2817 10.0.0.1:80 0.000073 0.001048 0.000057 200 200 0 29 "GET http://www.example.com:80/old HTTP/1.1"`)
+	if req.URI != "/old" || req.StatusCode != 200 || req.UserAgent != "" || req.TLSCipher != "" || req.TLSProtocol != "" {
+		t.Errorf("unexpected request %+v", *req)
+	}
+	_, err := inputs["elb"]().ParseString(`2015-05-13T23:39:43.945958Z my-loadbalancer 192.168.131.39:2817`)
+	if err == nil {
+		t.Error("expected error on short line")
+	}
+}
+
+const testCloudFront = "#Version: 1.0\n" +
+	"#Fields: date time x-edge-location sc-bytes c-ip cs-method cs(Host) cs-uri-stem sc-status cs(Referer) cs(User-Agent) cs-uri-query cs(Cookie) x-edge-result-type x-edge-request-id x-host-header cs-protocol cs-bytes time-taken x-forwarded-for ssl-protocol ssl-cipher x-edge-response-result-type cs-protocol-version\n" +
+	"2019-12-04\t21:02:31\tLAX1\t392\t192.0.2.100\tGET\td111111abcdef8.cloudfront.net\t/index.html\t200\t-\tMozilla/5.0%20(Windows%20NT%2010.0;%20Win64;%20x64)\tlang=en\t-\tHit\tSOX4xwn4XV6Q4rgb7XiVGOHms_BGlTAC4KyHmureZmBNrjGdRLiNIQ==\td111111abcdef8.cloudfront.net\thttps\t23\t0.001\t-\tTLSv1.2\tECDHE-RSA-AES128-GCM-SHA256\tHit\tHTTP/2.0\n"
+
+func TestCloudFront(t *testing.T) {
+	logOut = ioutil.Discard
+	defer func() { *inputName = "" }()
+	*inputName = "cloudfront"
+
+	dir, err := ioutil.TempDir("", "importlogs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := writeLog(t, dir, testCloudFront)
+
+	store := &memStore{}
+	err = importFile(name, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(store.reqs) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(store.reqs))
+	}
+	req := store.reqs[0]
+	if !req.ServerTime.Equal(time.Date(2019, 12, 4, 21, 2, 31, 0, time.UTC)) {
+		t.Errorf("unexpected time %v", req.ServerTime)
+	}
+	if req.URI != "/index.html?lang=en" || req.Protocol != "HTTP/2.0" || req.EdgeLocation != "LAX1" || req.Payload != 392 || req.RequestTime != 0.001 {
+		t.Errorf("unexpected request %+v", req)
+	}
+	if req.UserAgent != "Mozilla/5.0 (Windows NT 10.0; Win64; x64)" || req.VirtualHost != "d111111abcdef8.cloudfront.net" || req.TLSProtocol != "TLSv1.2" {
+		t.Errorf("unexpected request %+v", req)
+	}
+}
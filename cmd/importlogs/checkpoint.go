@@ -0,0 +1,212 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/klauspost/InterviewAssignment/traffic"
+)
+
+// headSize is the number of bytes at the start of a file
+// that are used to identify the file.
+const headSize = 4096
+
+// checkpoint records how much of a file has been stored.
+type checkpoint struct {
+	Path    string    `json:"path"`
+	Inode   uint64    `json:"inode"`    // Inode of the file. 0 if unknown.
+	Size    int64     `json:"size"`     // Size of the file when the checkpoint was made.
+	Head    string    `json:"head"`     // SHA-1 of the first HeadLen bytes of the file.
+	HeadLen int64     `json:"head_len"` // Number of bytes in Head.
+	Offset  int64     `json:"offset"`   // Offset after the last stored line in the (decompressed) content.
+	Lines   int64     `json:"lines"`    // Number of lines before Offset.
+	Updated time.Time `json:"updated"`
+}
+
+// identify returns a checkpoint at offset 0 identifying the open file.
+func identify(path string, f *os.File) (checkpoint, error) {
+	cp := checkpoint{Path: path}
+	st, err := f.Stat()
+	if err != nil {
+		return cp, err
+	}
+	cp.Inode = fileInode(st)
+	cp.Size = st.Size()
+
+	head := make([]byte, headSize)
+	n, err := f.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return cp, err
+	}
+	sum := sha1.Sum(head[:n])
+	cp.Head = hex.EncodeToString(sum[:])
+	cp.HeadLen = int64(n)
+	return cp, nil
+}
+
+// sameFile returns true if the file identified by cur is likely the same file
+// as the checkpoint, possibly with more content appended.
+func (c checkpoint) sameFile(cur checkpoint) bool {
+	if c.Inode != 0 && cur.Inode != 0 && c.Inode != cur.Inode {
+		return false
+	}
+	if cur.Size < c.Size {
+		return false
+	}
+	return cur.HeadLen == c.HeadLen && cur.Head == c.Head
+}
+
+// checkpoints contains the checkpoints of all files,
+// and writes them to a state file when they are updated.
+// Checkpoints can safely be accessed from multiple goroutines.
+type checkpoints struct {
+	path  string
+	mu    sync.Mutex
+	files map[string]checkpoint
+}
+
+// loadCheckpoints loads a state file.
+// If the file does not exist, it will be created when
+// the first checkpoint is saved.
+func loadCheckpoints(path string) (*checkpoints, error) {
+	c := &checkpoints{path: path, files: make(map[string]checkpoint)}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var files []checkpoint
+	err = json.Unmarshal(b, &files)
+	if err != nil {
+		return nil, fmt.Errorf("reading checkpoints from %s: %v", path, err)
+	}
+	for _, cp := range files {
+		c.files[cp.Path] = cp
+	}
+	return c, nil
+}
+
+// resume returns the checkpoint to resume the file from.
+// If no matching checkpoint is found, cur is returned.
+func (c *checkpoints) resume(cur checkpoint, f *os.File) checkpoint {
+	c.mu.Lock()
+	prev, ok := c.files[cur.Path]
+	c.mu.Unlock()
+	if !ok {
+		return cur
+	}
+	// If the file has grown within the head, hash it
+	// using the length of the previous checkpoint.
+	if cur.HeadLen > prev.HeadLen {
+		head := make([]byte, prev.HeadLen)
+		_, err := f.ReadAt(head, 0)
+		if err != nil {
+			return cur
+		}
+		sum := sha1.Sum(head)
+		if hex.EncodeToString(sum[:]) != prev.Head {
+			return cur
+		}
+		prev.Head, prev.HeadLen = cur.Head, cur.HeadLen
+	}
+	if !prev.sameFile(cur) {
+		return cur
+	}
+	cur.Offset, cur.Lines = prev.Offset, prev.Lines
+	return cur
+}
+
+// save will update the checkpoint of a file and write the state file.
+// The state file is replaced atomically.
+func (c *checkpoints) save(cp checkpoint) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cp.Updated = time.Now().UTC()
+	c.files[cp.Path] = cp
+
+	files := make([]checkpoint, 0, len(c.files))
+	for _, cp := range c.files {
+		files = append(files, cp)
+	}
+	b, err := json.MarshalIndent(files, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(c.path), filepath.Base(c.path))
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(b)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path)
+}
+
+// fileCheckpoint regularly saves the progress of a single file.
+// A nil *fileCheckpoint does nothing.
+type fileCheckpoint struct {
+	state *checkpoints
+	cp    checkpoint
+	last  time.Time
+}
+
+// newFileCheckpoint returns a checkpointer for the open file,
+// and the checkpoint to resume from.
+// If no state file is used, or stdin or a remote object is imported,
+// nil is returned. The store must acknowledge stored requests.
+func newFileCheckpoint(path string, f *os.File, store traffic.RequestStore) (*fileCheckpoint, checkpoint, error) {
+	if state == nil || path == "-" || f == nil {
+		return nil, checkpoint{}, nil
+	}
+	if _, ok := store.(traffic.AckStore); !ok {
+		return nil, checkpoint{}, fmt.Errorf("checkpoints are not supported by the store")
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil, checkpoint{}, err
+	}
+	cur, err := identify(path, f)
+	if err != nil {
+		return nil, checkpoint{}, err
+	}
+	cp := state.resume(cur, f)
+	return &fileCheckpoint{state: state, cp: cp, last: time.Now()}, cp, nil
+}
+
+// update will save a checkpoint if the checkpoint interval has passed.
+// All lines before offset must have been stored.
+func (f *fileCheckpoint) update(offset, lines int64) error {
+	if f == nil || time.Since(f.last) < *checkpointInterval {
+		return nil
+	}
+	return f.save(offset, lines)
+}
+
+// save will save a checkpoint.
+// All lines before offset must have been stored.
+func (f *fileCheckpoint) save(offset, lines int64) error {
+	if f == nil {
+		return nil
+	}
+	f.last = time.Now()
+	f.cp.Offset, f.cp.Lines = offset, lines
+	return f.state.save(f.cp)
+}
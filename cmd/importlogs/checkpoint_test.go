@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Tests that an import saves a checkpoint, and that
+// an import resumes from a saved checkpoint.
+func TestCheckpointResume(t *testing.T) {
+	logOut = ioutil.Discard
+	dir, err := ioutil.TempDir("", "importlogs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func() { state = nil }()
+
+	stateName := filepath.Join(dir, "state.json")
+	state, err = loadCheckpoints(stateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := "testdata/sample-log.txt.gz"
+	store := &memStore{}
+	err = importFile(file, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The last line does not match the format.
+	if len(store.reqs) != 15 {
+		t.Fatalf("expected 15 requests, got %d", len(store.reqs))
+	}
+
+	// Reload the state and check the checkpoint.
+	state, err = loadCheckpoints(stateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	abs, _ := filepath.Abs(file)
+	cp, ok := state.files[abs]
+	if !ok {
+		t.Fatal("no checkpoint saved for", abs)
+	}
+	if cp.Lines != 16 {
+		t.Fatalf("expected checkpoint after 16 lines, got %d", cp.Lines)
+	}
+
+	// Nothing should be imported again.
+	store = &memStore{}
+	err = importFile(file, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(store.reqs) != 0 {
+		t.Fatalf("expected no requests, got %d", len(store.reqs))
+	}
+
+	// Resume after the 10th line.
+	full := &memStore{}
+	state = nil
+	err = importFile(file, full)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err = loadCheckpoints(stateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset := lineOffset(t, file, 10)
+	cp.Offset, cp.Lines = offset, 10
+	state.files[abs] = cp
+	store = &memStore{}
+	err = importFile(file, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, want := store.URIs(), full.URIs()[10:]
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+}
+
+// Tests that a checkpoint is only used for the same file.
+func TestCheckpointSameFile(t *testing.T) {
+	cp := checkpoint{Path: "a", Inode: 1, Size: 100, Head: "x", HeadLen: 100, Offset: 50}
+	if !cp.sameFile(checkpoint{Path: "a", Inode: 1, Size: 200, Head: "x", HeadLen: 100}) {
+		t.Fatal("appended file was not the same file")
+	}
+	if cp.sameFile(checkpoint{Path: "a", Inode: 2, Size: 200, Head: "x", HeadLen: 100}) {
+		t.Fatal("file with another inode was the same file")
+	}
+	if cp.sameFile(checkpoint{Path: "a", Inode: 1, Size: 50, Head: "x", HeadLen: 50}) {
+		t.Fatal("truncated file was the same file")
+	}
+	if cp.sameFile(checkpoint{Path: "a", Inode: 1, Size: 100, Head: "y", HeadLen: 100}) {
+		t.Fatal("file with other content was the same file")
+	}
+}
+
+// lineOffset returns the offset after n lines in a gzipped file.
+func lineOffset(t *testing.T, file string, n int) int64 {
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := bufio.NewReader(gr)
+	var offset int64
+	for i := 0; i < n; i++ {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		offset += int64(len(line))
+	}
+	return offset
+}
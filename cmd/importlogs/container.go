@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/klauspost/InterviewAssignment/traffic"
+	"github.com/satyrius/gonx"
+)
+
+// Container log wrappings, selected with -container.
+const (
+	containerDocker = "docker" // Docker json-file records.
+	containerCRI    = "cri"    // Kubernetes CRI lines.
+)
+
+// applyContainer will check the container log wrapping.
+func applyContainer(name string) error {
+	switch name {
+	case containerDocker, containerCRI:
+		return nil
+	}
+	return fmt.Errorf("unknown container log %q. Available container logs: %s, %s", name, containerCRI, containerDocker)
+}
+
+// containerLog unwraps the lines written by a container runtime,
+// and joins lines that were split by the runtime.
+// It is not safe for concurrent use, since lines must be
+// unwrapped in the order they were written.
+type containerLog struct {
+	format  string
+	partial string // The beginning of a split line.
+}
+
+// newContainerLog returns an unwrapper of the selected container log.
+// If no container log is selected, nil is returned.
+func newContainerLog() *containerLog {
+	if *container == "" {
+		return nil
+	}
+	return &containerLog{format: *container}
+}
+
+// dockerRecord is a line of the Docker json-file log driver.
+type dockerRecord struct {
+	Log    string `json:"log"`
+	Stream string `json:"stream"`
+	Time   string `json:"time"`
+}
+
+// unwrap returns the line written by the container.
+// If the line is continued by the next line, complete is false.
+func (c *containerLog) unwrap(line string) (inner string, complete bool, err error) {
+	var partial bool
+	switch c.format {
+	case containerDocker:
+		// For example {"log":"10.0.0.1 - - [...] \"GET / HTTP/1.1\" 200 612\n","stream":"stdout","time":"..."}.
+		// Lines longer than 16KB are split into records without line feed.
+		var rec dockerRecord
+		err = json.Unmarshal([]byte(line), &rec)
+		if err != nil {
+			return "", false, err
+		}
+		inner = strings.TrimSuffix(rec.Log, "\n")
+		partial = inner == rec.Log
+	case containerCRI:
+		// For example "2016-10-06T00:17:09.669794202Z stdout F 10.0.0.1 - - [...]".
+		// The tag is P for partial lines and F for the last part of a line.
+		f := strings.SplitN(line, " ", 4)
+		if len(f) < 3 {
+			return "", false, fmt.Errorf("line is not a CRI log line")
+		}
+		if len(f) == 4 {
+			inner = f[3]
+		}
+		tag := strings.SplitN(f[2], ":", 2)[0]
+		switch tag {
+		case "F":
+		case "P":
+			partial = true
+		default:
+			return "", false, fmt.Errorf("unknown CRI log tag %q", f[2])
+		}
+	}
+	if partial {
+		c.partial += inner
+		return "", false, nil
+	}
+	inner, c.partial = c.partial+inner, ""
+	return inner, true, nil
+}
+
+// Kubernetes log file paths.
+// See https://github.com/kubernetes/kubernetes/blob/master/pkg/kubelet/kuberuntime/helpers.go
+var (
+	// /var/log/containers/<pod>_<namespace>_<container>-<container id>.log
+	k8sContainerLog = regexp.MustCompile(`^([^_/]+)_([^_/]+)_(.+)-([0-9a-f]{64})\.log`)
+	// /var/log/pods/<namespace>_<pod>_<pod uid>/<container>/<restart count>.log
+	k8sPodLog = regexp.MustCompile(`(?:^|/)([^_/]+)_([^_/]+)_[^_/]+/([^/]+)/[0-9]+\.log`)
+	// /var/lib/docker/containers/<container id>/<container id>-json.log
+	dockerLog = regexp.MustCompile(`(?:^|/)([0-9a-f]{64})/[0-9a-f]{64}-json\.log`)
+)
+
+// containerPathMeta returns the container metadata in the path of a
+// container log file, as fields that are added to each line.
+// If the path contains no metadata, nil is returned.
+func containerPathMeta(path string) map[string]string {
+	path = filepath.ToSlash(path)
+	if m := k8sContainerLog.FindStringSubmatch(filepath.Base(path)); m != nil {
+		return map[string]string{"k8s_pod": m[1], "k8s_namespace": m[2], "container_name": m[3], "container_id": m[4]}
+	}
+	if m := k8sPodLog.FindStringSubmatch(path); m != nil {
+		return map[string]string{"k8s_namespace": m[1], "k8s_pod": m[2], "container_name": m[3]}
+	}
+	if m := dockerLog.FindStringSubmatch(path); m != nil {
+		return map[string]string{"container_id": m[1]}
+	}
+	return nil
+}
+
+// parseContainer returns the container metadata of an entry.
+// If the entry has no metadata, nil is returned.
+func parseContainer(rec *gonx.Entry) *traffic.Container {
+	c := traffic.Container{
+		Namespace: optField(rec, "k8s_namespace"),
+		Pod:       optField(rec, "k8s_pod"),
+		Name:      optField(rec, "container_name"),
+		ID:        optField(rec, "container_id"),
+	}
+	if c == (traffic.Container{}) {
+		return nil
+	}
+	return &c
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/InterviewAssignment/traffic"
+)
+
+func TestContainerUnwrap(t *testing.T) {
+	for _, test := range []struct {
+		format string
+		lines  []string
+		want   []string // The unwrapped lines, "" for partial lines.
+	}{
+		{
+			format: containerDocker,
+			lines: []string{
+				`{"log":"10.0.0.1 - - [13/Sep/2016:11:08:03 +0000] \"GET / HTTP/1.1\" 200 612\n","stream":"stdout","time":"2016-09-13T11:08:03.123456789Z"}`,
+				`{"log":"10.0.0.1 - - [13/Sep/2016:11:08:04 +0000] \"GET /long","stream":"stdout","time":"2016-09-13T11:08:04Z"}`,
+				`{"log":"er HTTP/1.1\" 200 1\n","stream":"stdout","time":"2016-09-13T11:08:04Z"}`,
+			},
+			want: []string{
+				`10.0.0.1 - - [13/Sep/2016:11:08:03 +0000] "GET / HTTP/1.1" 200 612`,
+				"",
+				`10.0.0.1 - - [13/Sep/2016:11:08:04 +0000] "GET /longer HTTP/1.1" 200 1`,
+			},
+		},
+		{
+			format: containerCRI,
+			lines: []string{
+				`2016-10-06T00:17:09.669794202Z stdout F 10.0.0.1 - - [06/Oct/2016:00:17:09 +0000] "GET / HTTP/1.1" 200 612`,
+				`2016-10-06T00:17:10.000000000Z stdout P 10.0.0.1 - - [06/Oct/2016:00:17:10 +0000] `,
+				`2016-10-06T00:17:10.000000000Z stdout P "GET /a`,
+				`2016-10-06T00:17:10.000000000Z stdout F  HTTP/1.1" 200 1`,
+				`2016-10-06T00:17:11.000000000Z stderr F`,
+			},
+			want: []string{
+				`10.0.0.1 - - [06/Oct/2016:00:17:09 +0000] "GET / HTTP/1.1" 200 612`,
+				"",
+				"",
+				`10.0.0.1 - - [06/Oct/2016:00:17:10 +0000] "GET /a HTTP/1.1" 200 1`,
+				"",
+			},
+		},
+	} {
+		c := &containerLog{format: test.format}
+		for i, line := range test.lines {
+			got, complete, err := c.unwrap(line)
+			if err != nil {
+				t.Fatalf("%s line %d: %v", test.format, i, err)
+			}
+			if got != test.want[i] || complete != (i == len(test.lines)-1 || test.want[i] != "") {
+				t.Errorf("%s line %d: got %q (complete: %v), want %q", test.format, i, got, complete, test.want[i])
+			}
+		}
+	}
+
+	for format, line := range map[string]string{
+		containerDocker: `10.0.0.1 - - [13/Sep/2016:11:08:03 +0000] "GET / HTTP/1.1" 200 612`,
+		containerCRI:    `2016-10-06T00:17:09.669794202Z stdout X line`,
+	} {
+		c := &containerLog{format: format}
+		_, _, err := c.unwrap(line)
+		if err == nil {
+			t.Errorf("%s: expected error on %q", format, line)
+		}
+	}
+}
+
+func TestContainerPathMeta(t *testing.T) {
+	id := strings.Repeat("0123456789abcdef", 4)
+	for path, want := range map[string]map[string]string{
+		"/var/log/containers/web-5d8f7_shop_nginx-" + id + ".log":                 {"k8s_pod": "web-5d8f7", "k8s_namespace": "shop", "container_name": "nginx", "container_id": id},
+		"/var/log/pods/shop_web-5d8f7_8a7d2c1e-0b6f-4c1a/nginx/0.log":             {"k8s_namespace": "shop", "k8s_pod": "web-5d8f7", "container_name": "nginx"},
+		"/var/log/pods/shop_web-5d8f7_8a7d2c1e-0b6f-4c1a/nginx/0.log.20161006.gz": {"k8s_namespace": "shop", "k8s_pod": "web-5d8f7", "container_name": "nginx"},
+		"/var/lib/docker/containers/" + id + "/" + id + "-json.log.1":             {"container_id": id},
+		"/var/log/nginx/access.log":                                               nil,
+	} {
+		if got := containerPathMeta(path); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", path, got, want)
+		}
+	}
+}
+
+const testCRI = `2016-10-06T00:17:09.669794202Z stdout F 10.0.0.1 - - [06/Oct/2016:00:17:09 +0000] "GET /a HTTP/1.1" 200 612
+2016-10-06T00:17:10.000000000Z stdout P 10.0.0.2 - - [06/Oct/2016:00:17:10 +0000] "GET /b
+2016-10-06T00:17:10.000000000Z stdout F  HTTP/1.1" 200 1
+`
+
+// Tests that CRI logs are unwrapped, joined and annotated with the pod.
+func TestImportContainer(t *testing.T) {
+	logOut = ioutil.Discard
+	defer func() { *container, *containerMeta, *format = "", false, presets["nasa"].format }()
+	*container, *containerMeta = containerCRI, true
+	*format = `$remote_addr - - [$time_local] "$request" $status $size`
+
+	dir, err := ioutil.TempDir("", "importlogs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "shop_web-5d8f7_8a7d2c1e", "nginx", "0.log")
+	err = os.MkdirAll(filepath.Dir(name), 0777)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(name, []byte(testCRI), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := &memStore{}
+	err = importFile(name, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(store.URIs(), ","); got != "/a,/b" {
+		t.Fatalf("unexpected URIs %s", got)
+	}
+	want := &traffic.Container{Namespace: "shop", Pod: "web-5d8f7", Name: "nginx"}
+	if !reflect.DeepEqual(store.reqs[1].Container, want) || store.reqs[1].StatusCode != 200 {
+		t.Errorf("unexpected request %+v", store.reqs[1])
+	}
+
+	// Resuming after the partial line must join it with the next line.
+	f := newFileImport(name, store)
+	fi, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fi.Close()
+	_, err = f.resume(fi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.replay() {
+		t.Fatal("expected skipped lines to be read")
+	}
+	err = f.skipLines(bufio.NewReader(fi), int64(strings.LastIndex(testCRI, "2016-")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, complete, err := f.container.unwrap(`2016-10-06T00:17:10.000000000Z stdout F  HTTP/1.1" 200 1`)
+	if err != nil || !complete || line != `10.0.0.2 - - [06/Oct/2016:00:17:10 +0000] "GET /b HTTP/1.1" 200 1` {
+		t.Errorf("unexpected line %q, complete: %v, error: %v", line, complete, err)
+	}
+	f.finish()
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Policies for lines that cannot be parsed.
+const (
+	policyAbort      = "abort"      // Stop importing the file.
+	policySkip       = "skip"       // Skip the line.
+	policyDeadLetter = "deadletter" // Write the line to the dead-letter file.
+)
+
+// errKindFormat is the kind of error when a line does not match the log format.
+const errKindFormat = "format"
+
+// lineError is an error parsing a single line.
+type lineError struct {
+	Kind string // The field that could not be parsed, or errKindFormat.
+	Err  error
+}
+
+func (e *lineError) Error() string {
+	return e.Kind + ": " + e.Err.Error()
+}
+
+// errKind returns the kind of a parse error.
+func errKind(err error) string {
+	if le, ok := err.(*lineError); ok {
+		return le.Kind
+	}
+	return "unknown"
+}
+
+// abortError is returned when the abort policy stops an import at a line.
+type abortError struct {
+	Seq int64 // The line number.
+	Err error
+}
+
+func (e *abortError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Seq, e.Err)
+}
+
+// deadLetter is a rejected line written to the dead-letter file.
+type deadLetter struct {
+	File  string `json:"file"`
+	Line  int64  `json:"line"`
+	Kind  string `json:"kind"`
+	Error string `json:"error"`
+	Raw   string `json:"raw"`
+}
+
+// deadLetterWriter writes rejected lines as newline delimited JSON.
+// It can safely be used from multiple goroutines.
+type deadLetterWriter struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+// Write a rejected line.
+func (d *deadLetterWriter) Write(file string, line int64, raw string, err error) error {
+	b, jerr := json.Marshal(deadLetter{File: file, Line: line, Kind: errKind(err), Error: err.Error(), Raw: raw})
+	if jerr != nil {
+		return jerr
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, jerr = d.out.Write(append(b, '\n'))
+	return jerr
+}
+
+// rejections counts rejected lines by kind of error.
+type rejections map[string]int
+
+// String returns a summary sorted by kind, for example "format=2, status=1".
+func (r rejections) String() string {
+	kinds := make([]string, 0, len(r))
+	for k := range r {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+	for i, k := range kinds {
+		kinds[i] = fmt.Sprintf("%s=%d", k, r[k])
+	}
+	return strings.Join(kinds, ", ")
+}
+
+// total returns the number of rejected lines.
+func (r rejections) total() int {
+	n := 0
+	for _, v := range r {
+		n += v
+	}
+	return n
+}
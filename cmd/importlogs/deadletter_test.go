@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeLog writes lines to a temporary log file.
+func writeLog(t *testing.T, dir string, lines ...string) string {
+	name := filepath.Join(dir, "access.log")
+	err := ioutil.WriteFile(name, []byte(strings.Join(lines, "")), 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+// Tests the policies for lines that cannot be parsed.
+func TestRejectPolicy(t *testing.T) {
+	logOut = ioutil.Discard
+	dir, err := ioutil.TempDir("", "importlogs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func() {
+		*onError = policyAbort
+		rejected = nil
+	}()
+
+	badStatus := strings.Replace(logLine("/bad"), " 200 ", " abc ", 1)
+	name := writeLog(t, dir, logLine("/a"), "garbage\n", badStatus, logLine("/b"))
+
+	// Abort stops at the bad status, but skips the garbage line.
+	*onError = policyAbort
+	store := &memStore{}
+	err = importFile(name, store)
+	if err == nil || !strings.HasPrefix(err.Error(), "line 3: status: ") {
+		t.Fatalf("expected error on line 3, got %v", err)
+	}
+
+	// Skip imports the valid lines.
+	*onError = policySkip
+	store = &memStore{}
+	f := newFileImport(name, store)
+	fi, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fi.Close()
+	_, err = f.resume(fi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.importLines(bufio.NewReader(fi))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = f.finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(store.URIs(), ","); got != "/a,/b" {
+		t.Fatalf("expected /a,/b, got %s", got)
+	}
+	if got := f.rejected.String(); got != "format=1, status=1" {
+		t.Fatalf("unexpected rejections %q", got)
+	}
+
+	// Dead-letter writes the rejected lines.
+	*onError = policyDeadLetter
+	var buf bytes.Buffer
+	rejected = &deadLetterWriter{out: &buf}
+	err = importFile(name, &memStore{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []deadLetter
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var d deadLetter
+		err := dec.Decode(&d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, d)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 dead letters, got %d", len(got))
+	}
+	if got[0].File != name || got[0].Line != 2 || got[0].Kind != "format" || got[0].Raw != "garbage" {
+		t.Fatalf("unexpected dead letter %+v", got[0])
+	}
+	if got[1].Line != 3 || got[1].Kind != "status" || got[1].Raw != strings.TrimSpace(badStatus) {
+		t.Fatalf("unexpected dead letter %+v", got[1])
+	}
+}
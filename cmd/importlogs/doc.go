@@ -2,13 +2,42 @@
 importlogs will import apache/nginx style logs into an elasticsearch database.
 
   usage: importlogs [flags] file1.gz [file2.gz...]
-        Imports gzipped log files.
+        Imports log files. gzip, bzip2 and zlib compression is detected.
+        Use - to import from stdin. http://, https:// and s3://bucket/prefix
+        arguments import remote objects.
+         importlogs -follow [flags] file1.log [file2.log...]
+        Imports plain text log files and follows them as they grow.
+         importlogs [flags] listen [udp://host:port] [tcp://host:port] [http://host:port/path...]
+        Imports log lines received as syslog messages or pushed over HTTP.
 
   flags:
 
+  -checkpoint string
+        state file used to resume interrupted imports.
+        See "Resuming imports" below.
+
+  -checkpoint-interval duration
+        interval between saved checkpoints (default 10s)
+
   -clean
         clean the index before adding content
 
+  -container string
+        unwrap lines written by a container runtime: docker or cri.
+        See "Container logs" below.
+
+  -container-meta
+        add the namespace, pod, container name and container ID in the
+        path of each file to the requests. Used with -container.
+
+  -deadletter string
+        NDJSON file receiving rejected lines with -on-error=deadletter.
+        Lines are appended to the file.
+
+  -download-retries int
+        number of attempts to resume an interrupted download (default 5).
+        See "Importing from URLs" below.
+
   -e
         continue to next file if an error occurs
 
@@ -16,21 +45,387 @@ importlogs will import apache/nginx style logs into an elasticsearch database.
         url to elasticseach server (http) (default "http://127.0.0.1:9200")
         Overriden if environment variable "ELASTICSEARCH_PORT_9200_TCP" is set.
 
+  -apache-format string
+        Apache LogFormat string describing the log format.
+        See "Apache LogFormat" below.
+
+  -envoy-format string
+        read logs written with an Envoy access log format: default, istio,
+        a text format or a JSON format. See "Envoy logs" below.
+
+  -error-log string
+        read error logs instead of access logs: apache or nginx.
+        See "Error logs" below.
+
+  -files-parallel int
+        number of files imported at the same time (default 1)
+
+  -follow
+        follow plain text log files as they grow, handling rotation.
+        See "Following log files" below.
+
   -format string
-        Log format (default "$remote_addr - - [$time_local] \"$method $uri $protocol\" $status $size")
+        Log format (default "$remote_addr - - [$time_local] \"$request\" $status $size")
 
   -geodb string
         Path to MaxMind GeoLite2 or GeoIP2 mmdb database to translate IP to location.
 
+  -input string
+        read logs of a specific server: alb, cloudfront, elb, haproxy, squid or w3c.
+        See "W3C extended logs", "AWS logs", "HAProxy logs" and "Squid logs" below.
+
+  -json string
+        read JSON lines with a built-in mapping: caddy, nginx or traefik.
+        See "JSON logs" below.
+
+  -json-map string
+        read JSON lines, mapping fields to JSON keys: field=key,...
+        Added to the -json mapping.
+
+  -nginx-conf string
+        read the log format from an nginx configuration file.
+        See "nginx configuration" below.
+
+  -nginx-format string
+        name of the log_format in the -nginx-conf file (default "main")
+
+  -on-error string
+        policy for lines that cannot be parsed: abort, skip or deadletter (default "abort").
+        See "Rejected lines" below.
+
+  -preset string
+        named log format: combined, common, nasa, nginx or vhost_combined.
+        Sets -format and -timeformat. See "Format presets" below.
+
+  -poll duration
+        interval between checks for new data in follow mode (default 1s)
+
   -timeformat string
         Time format in Go time.Parse format. (default "02/Jan/2006:15:04:05 -0700").
         See https://golang.org/pkg/time/#Parse for more information on the format.
 
+  -queue int
+        number of lines queued for parsing and storing in each file (default 1000)
+
+  -salvage
+        import what can be decoded from truncated or corrupted gzip files.
+        See "Compressed files" below.
+
+  -s3-endpoint string
+        endpoint of S3 compatible storage, for example http://minio:9000.
+        Default is AWS S3 in the -s3-region. See "Importing from S3" below.
+
+  -s3-region string
+        region used to sign S3 requests.
+        Default is $AWS_REGION, $AWS_DEFAULT_REGION or us-east-1.
+
+  -workers int
+        number of goroutines parsing and enriching lines of each file
+        (default is the number of CPUs)
+
   -test
   		write json representation of requests to stdout.
   		This can be used to test a filter, and observe enrichment data.
 		Note that the JSON representation is unordered.
 
+Format presets
+
+Instead of writing a -format, one of the built-in presets can be selected with -preset.
+A preset sets both the log format and the time format. -format cannot be combined
+with a preset, but -timeformat overrides the time format of the preset.
+
+  nasa            The NASA reference logs. This is the default format.
+  common          Apache "common": %h %l %u %t "%r" %>s %b
+  combined        Apache "combined": common with referer and user agent.
+  vhost_combined  Apache "vhost_combined": combined prefixed by the virtual host and port.
+  nginx           The nginx "main" format: combined with X-Forwarded-For.
+
+nginx configuration
+
+With -nginx-conf, the log format is read from a log_format directive in an nginx
+configuration, so the format always matches the server:
+
+  importlogs -nginx-conf /etc/nginx/nginx.conf -nginx-format main access.log.gz
+
+Formats split over several lines and strings are joined as nginx does.
+Values written with escape=default (\xHH) or escape=json are unescaped.
+Included files are not read. If "combined" is not defined, the predefined nginx
+format is used. -format and -preset cannot be used with -nginx-conf.
+
+Apache LogFormat
+
+With -apache-format, the log format is given as an Apache mod_log_config format
+string, or a complete LogFormat directive:
+
+  importlogs -apache-format '%h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-Agent}i" %D' access.log
+
+Headers are named as nginx does, so %{User-Agent}i is "http_user_agent". %D and
+%T set the request time. The time format is generated from %t or %{format}t, and
+time specifiers separated only by text, like "%{%d/%b/%Y %T}t.%{msec_frac}t",
+are combined. An explicit -timeformat overrides the generated time format.
+Values escaped by Apache are unescaped.
+-format, -preset and -nginx-conf cannot be used with -apache-format.
+
+JSON logs
+
+With -json or -json-map, every line is read as a JSON object. The mapping
+selects the JSON key of each field, and the values are parsed as the fields
+described below. Nested keys are separated by dots, several keys can be given
+separated by '|', and arrays are joined by ", ". Numbers are used as written,
+so timestamps can be mapped to "msec", "time_msec" or "time_usec", and
+strings to "time_iso8601" or "time_local".
+
+  importlogs -json caddy access.log
+  importlogs -json-map 'remote_addr=client.ip,uri=http.path,time_msec=timestamp' app.log
+
+Top level keys that are not mapped are used as fields with the same name.
+The built-in mappings are:
+
+  nginx    log_format escape=json, with keys named as the variables.
+  caddy    Caddy v2 access logs.
+  traefik  Traefik access logs with format=json.
+
+W3C extended logs
+
+With -input w3c, W3C extended logs, as written by IIS, are read. The columns are
+declared by #Fields directives, which can change in the middle of a file.
+#Date sets the date of lines without a date column, and if #Software is IIS,
+'+' in headers is read as a space and time-taken is in milliseconds.
+
+Columns are mapped to the fields described below: c-ip is "remote_addr",
+cs-method is "method", cs-uri-stem and cs-uri-query are "uri", sc-status is
+"status", sc-bytes is "bytes_sent", time-taken is "request_time", cs-username is
+"remote_user", cs-host is "host", and headers like cs(User-Agent) are named as
+nginx does. date and time are in UTC.
+
+When an import is resumed, the lines before the checkpoint are read to find the
+directives that apply.
+
+AWS logs
+
+With -input alb or -input elb, AWS Application and Classic Load Balancer logs are
+read. The client is "remote_addr", the target is "upstream_addr", the status of
+the load balancer is "status" and the status of the target is "upstream_status".
+The request time is the sum of the request, target and response processing
+times, and the target processing time is "upstream_response_time". The absolute
+URI of the request sets the virtual host. TLS cipher and protocol are stored,
+and the trace ID is "request_id".
+
+With -input cloudfront, CloudFront logs are read as W3C logs separated by tabs.
+x-edge-location is "edge_location", x-host-header is "server_name", and
+URL-encoded headers, like cs(User-Agent), are decoded.
+
+HAProxy logs
+
+With -input haproxy, lines written by HAProxy with "option httplog" are read,
+with or without a syslog header. The accept date has no time zone, and is read
+in the local time zone. The frontend, backend and server names are stored. Ta
+is the request time and Tr is the upstream response time. The termination state,
+the timers TR/Tw/Tc/Tr/Ta in milliseconds, connection counts, retries and queues
+are stored in the "haproxy" object.
+
+Squid logs
+
+With -input squid, the native access log of Squid is read. The result code,
+like TCP_MISS/200, is split into the cache result and the status, and the
+hierarchy code, like HIER_DIRECT/10.0.0.5, into the hierarchy and the upstream
+address. The destination host is taken from the URL, or from host:port of
+CONNECT requests. These are stored in "cache_result", "hierarchy" and
+"dest_host", so cache hit ratios and destinations can be charted.
+
+Envoy logs
+
+With -envoy-format, logs written by Envoy are read. The format is the name of a
+built-in format, "default" for the Envoy default format and "istio" for the
+Istio proxy format, or the text or JSON format of the access log configuration:
+
+  importlogs -envoy-format istio access.log
+  importlogs -envoy-format '{"start":"%START_TIME%","path":"%REQ(:PATH)%"}' access.log
+
+Command operators are translated to fields. DURATION is the request time,
+X-ENVOY-UPSTREAM-SERVICE-TIME the upstream response time, UPSTREAM_CLUSTER
+the backend and UPSTREAM_HOST the upstream address. Response flags, like UH
+or UF, are stored as a list in "response_flags".
+
+Error logs
+
+With -error-log apache or -error-log nginx, error logs are read instead of
+access logs. Apache 2.4 lines with the default ErrorLogFormat and Apache 2.2
+lines are read. The time, level, module, pid, tid, client and message of each
+line are stored in "errors-yyyy.mm.dd" indexes, separate from the requests,
+so error log lines can be shown next to the requests of the same time.
+Times have no time zone, and are read in the local time zone.
+
+  importlogs -error-log nginx /var/log/nginx/error.log
+
+Container logs
+
+Containers often log to stdout, where each line is wrapped by the container
+runtime. With -container docker, lines are read from Docker json-file records,
+and with -container cri from Kubernetes CRI lines. The wrapped line is parsed
+with the selected log format. Lines split by the runtime are joined.
+
+With -container-meta, the namespace, pod, container name and container ID are
+read from the path of the file, for example /var/log/pods/<namespace>_<pod>_<uid>/<container>/0.log,
+/var/log/containers/<pod>_<namespace>_<container>-<id>.log or
+/var/lib/docker/containers/<id>/<id>-json.log, and stored in the
+"container" object of each request.
+
+  importlogs -container cri -container-meta -preset nginx /var/log/pods/shop_web-5d8f7_8a7d2c1e/nginx/0.log
+
+Compressed files
+
+The compression of each file is detected from the first bytes of the file.
+gzip (including multi-member files), bzip2 and zlib are supported, and other
+files are imported as plain text. Additional formats can be registered with
+the decompress package.
+
+With -salvage, gzip files are read even if they are truncated or corrupted.
+All lines decoded before the damage are imported, and decoding resumes at the
+next gzip member header. The number of damaged regions, the skipped compressed
+bytes and the discarded incomplete lines are reported for each file.
+
+Importing from URLs
+
+http:// and https:// arguments are downloaded and imported while they are read,
+without temporary files. The compression is detected like files:
+
+  importlogs -preset combined https://logs.example.com/2016/10/access.log.gz
+
+If a download is interrupted, or no data is received for a minute, the rest
+of the object is requested with a Range request, up to -download-retries times
+in a row. The response must have the ETag of the first response, which is also
+sent in If-Match, and the object must have the size of the first response.
+Otherwise the download fails, since the object was changed. Responses without
+a length cannot be resumed. Checkpoints are not used, and remote objects cannot
+be followed.
+
+Importing from S3
+
+An s3://bucket/prefix argument imports all objects in the bucket with the
+prefix, in the order of their keys. Objects are streamed without being saved,
+and their compression is detected like files. Any S3 compatible storage can be
+used by setting -s3-endpoint, for example MinIO:
+
+  AWS_ACCESS_KEY_ID=... AWS_SECRET_ACCESS_KEY=... \
+    importlogs -s3-endpoint http://minio:9000 -preset nginx s3://logs/web1/2016/
+
+Requests are signed with AWS Signature Version 4, using the credentials in
+AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN. Without
+credentials, requests are not signed, which can be used with public buckets.
+Buckets are addressed in the path of the endpoint. Interrupted downloads are
+resumed like URLs.
+
+Following log files
+
+With -follow, the files are read as plain text from the beginning,
+and lines are imported as they are written. Each file is followed until
+the process receives an interrupt or termination signal.
+
+Rotation is detected by file identity (inode) and size:
+      - rename and delaycompress: when a new file appears at the path,
+      the remainder of the old file is imported before switching to the new file.
+      With -checkpoint, the checkpoint of the old file is saved when its lines
+      are stored, before the new file is read.
+
+      - copytruncate: when the file becomes smaller than the
+      imported content, it is read again from the beginning.
+
+Receiving syslog messages
+
+With listen, log lines are received as syslog messages instead of read from
+files, so nginx and HAProxy can send their logs directly to the importer.
+Each address is udp://host:port or tcp://host:port, and by default messages
+are received on UDP and TCP port 514:
+
+  importlogs -preset nginx listen udp://:5140 tcp://:5140
+
+RFC 5424 and RFC 3164 messages are read. Over TCP, messages are either
+octet counted or terminated by a line feed (RFC 6587). Messages are at most
+64 KiB, and a connection sending a longer message is closed. The syslog header is
+removed, and the payload is parsed with the selected log format. The host and
+app of the header are stored in "syslog_host" and "syslog_app".
+Messages that cannot be imported are logged and rejected, also with
+-on-error=abort, so a bad message does not stop the listener. Messages the
+store rejects are logged. If the store fails, for example when elasticsearch
+cannot be reached, the process exits with an error, so it can be restarted.
+
+When the import cannot keep up, messages are not read until there is room in
+the -queue. TCP senders are slowed down, while UDP messages may be dropped by
+the operating system. Messages are received until the process receives an
+interrupt or termination signal. Checkpoints are not used.
+
+Pushing logs over HTTP
+
+An http://host:port/path address serves an endpoint receiving batches of log
+lines, for hosts that cannot send syslog. The body of a POST request contains
+newline delimited lines, and may be gzip encoded with "Content-Encoding: gzip".
+By default lines are parsed with the selected log format. A batch can select
+another format with the "X-Log-Source" header, naming a preset or input, or the
+"X-Log-Format" header, containing a log format like -format:
+
+  importlogs -preset nginx listen http://:8080/logs
+  curl --data-binary @access.log -H 'X-Log-Source: combined' http://localhost:8080/logs
+
+Times are parsed with -timeformat. The response is sent when the lines of the
+batch are stored, and contains the number of accepted and rejected lines:
+
+  {"accepted":1043,"rejected":2}
+
+If the body cannot be read, or -on-error=abort stops the batch at a line that
+cannot be parsed, the status is 400 and "error" contains the reason. If lines
+cannot be stored, the status is 500 and "failed" contains the number of lines
+the store did not accept. Lines before the error may be stored.
+
+A batch may contain up to 64 MiB, also after decompression, and must be sent
+within 5 minutes. Lines longer than 64 KiB are rejected with the error kind
+"length". A larger batch is stopped with status 400.
+
+Resuming imports
+
+With -checkpoint, the progress of every file is saved to a JSON state file.
+A checkpoint contains the offset after the last line acknowledged by the store,
+where all previous lines have also been stored. Checkpoints are saved every
+-checkpoint-interval and when a file has been imported.
+
+Each checkpoint records the path, inode, size and a SHA-1 checksum of the first
+4KB of the file, together with the offset and number of lines stored.
+When a file is imported again, the checkpoint is only used if the file
+is the same. Plain files continue at the offset. Compressed files are
+decompressed and the content before the offset is skipped.
+
+Parallel processing
+
+Each file is read by a single goroutine. The lines are parsed, hashed and
+enriched by -workers goroutines, and a sequencer restores the order of the
+lines before they are sent to the store. At most -queue lines of each file
+are being parsed or waiting for the sequencer, also when a line is slow to parse.
+
+Run "go test -bench=Import" to measure the scaling on your machine.
+
+With -files-parallel, several files are imported at the same time into the
+same store. Progress, rejected lines and errors are reported for each file.
+With -e an error in one file does not stop the other files, and the exit code
+is 2 if any file failed. Without -e the importer exits on the first error.
+
+Rejected lines
+
+Lines that cannot be parsed are handled according to the -on-error policy:
+      - "abort": stop importing the file if a field cannot be parsed.
+      Lines that do not match the format are skipped.
+
+      - "skip": skip all lines that cannot be parsed.
+
+      - "deadletter": skip the lines, and write them to the -deadletter file.
+
+Each dead-letter record is a JSON object on a single line:
+
+  {"file":"access.log","line":3,"kind":"status","error":"status: ...","raw":"..."}
+
+The kind is the name of the field that could not be parsed, or "format"
+if the line does not match the log format. When a file has been imported,
+the number of rejected lines of each kind is printed.
+
 Specifying custom log formatting
 
 You can specify a custom log parsing format. The default parse format is matching content at http://ita.ee.lbl.gov/html/contrib/NASA-HTTP.html
@@ -50,14 +445,69 @@ The following fields are recognized and extracted:
 	- "protocol"
       The request protocol.
 
+	- "request"
+      The request line, for example "GET / HTTP/1.1".
+      Sets method, uri and protocol. A request without a protocol is an HTTP/0.9
+      request. Request lines with spaces in the URI, a missing URI or binary data
+      are imported with "malformed_request" set. If no method is found, the whole
+      line is used as the URI.
+
 	- "time_local"
       The local server time.
       The time must be parseable with the "-timeformat".
 
+	- "time_iso8601"
+      The local server time in ISO 8601 format.
+
+	- "msec", "time_msec", "time_usec"
+      The time since the epoch in seconds (with fraction), milliseconds or microseconds.
+
 	- "status"
       The server status reply code.
 
 	- "size"
       Size of the reply in bytes. Can be '-' on bodyless replies.
+      "body_bytes_sent" and "bytes_sent" are also accepted.
+
+	- "remote_user"
+      The authenticated user.
+
+	- "http_referer"
+      The Referer header.
+
+	- "http_user_agent"
+      The User-Agent header.
+
+	- "server_name" or "host"
+      The virtual host serving the request.
+
+	- "request_time", "request_time_ms", "request_time_us", "request_time_ns"
+      The time taken to serve the request in seconds (with fraction),
+      milliseconds, microseconds or nanoseconds.
+
+	- "upstream_response_time"
+      The time spent waiting for upstream servers in seconds.
+      With several upstream servers, the times are added.
+
+	- "upstream_addr"
+      The address of the upstream servers.
+
+	- "upstream_status"
+      The status returned by the upstream server.
+
+	- "ssl_protocol", "ssl_cipher"
+      The TLS protocol and cipher of the connection.
+
+	- "edge_location"
+      The CDN edge location serving the request.
+
+	- "http_x_forwarded_for"
+      The X-Forwarded-For header.
+
+	- "request_id", "http_x_request_id" or "env_unique_id"
+      The unique ID of the request.
+
+The optional fields can be '-' if the value is unknown.
+Other fields in the format are ignored.
 */
 package main
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// envoyFormats are the built-in Envoy formats.
+var envoyFormats = map[string]string{
+	// The default format of Envoy.
+	// See https://www.envoyproxy.io/docs/envoy/latest/configuration/observability/access_log/usage#default-format-string
+	"default": `[%START_TIME%] "%REQ(:METHOD)% %REQ(X-ENVOY-ORIGINAL-PATH?:PATH)% %PROTOCOL%" ` +
+		`%RESPONSE_CODE% %RESPONSE_FLAGS% %BYTES_RECEIVED% %BYTES_SENT% %DURATION% ` +
+		`%RESP(X-ENVOY-UPSTREAM-SERVICE-TIME)% "%REQ(X-FORWARDED-FOR)%" "%REQ(USER-AGENT)%" ` +
+		`"%REQ(X-REQUEST-ID)%" "%REQ(:AUTHORITY)%" "%UPSTREAM_HOST%"`,
+	// The default text format of Istio.
+	"istio": `[%START_TIME%] "%REQ(:METHOD)% %REQ(X-ENVOY-ORIGINAL-PATH?:PATH)% %PROTOCOL%" ` +
+		`%RESPONSE_CODE% %RESPONSE_FLAGS% %RESPONSE_CODE_DETAILS% %CONNECTION_TERMINATION_DETAILS% ` +
+		`"%UPSTREAM_TRANSPORT_FAILURE_REASON%" %BYTES_RECEIVED% %BYTES_SENT% %DURATION% ` +
+		`%RESP(X-ENVOY-UPSTREAM-SERVICE-TIME)% "%REQ(X-FORWARDED-FOR)%" "%REQ(USER-AGENT)%" ` +
+		`"%REQ(X-REQUEST-ID)%" "%REQ(:AUTHORITY)%" "%UPSTREAM_HOST%" %UPSTREAM_CLUSTER% ` +
+		`%UPSTREAM_LOCAL_ADDRESS% %DOWNSTREAM_LOCAL_ADDRESS% %DOWNSTREAM_REMOTE_ADDRESS% ` +
+		`%REQUESTED_SERVER_NAME% %ROUTE_NAME%`,
+}
+
+// envoyOperator matches a command operator, for example %REQ(USER-AGENT):10%.
+var envoyOperator = regexp.MustCompile(`%([A-Z_]+)(?:\(([^)]*)\))?(?::[0-9]+)?%`)
+
+// envoyFields maps command operators without arguments to field names.
+// Other operators are named in lower case.
+var envoyFields = map[string]string{
+	"PROTOCOL":                               "protocol",
+	"RESPONSE_CODE":                          "status",
+	"RESPONSE_FLAGS":                         "response_flags",
+	"BYTES_RECEIVED":                         "bytes_received",
+	"BYTES_SENT":                             "bytes_sent",
+	"DURATION":                               "request_time_ms",
+	"UPSTREAM_HOST":                          "upstream_addr",
+	"UPSTREAM_CLUSTER":                       "backend",
+	"DOWNSTREAM_REMOTE_ADDRESS":              "downstream_remote_address",
+	"DOWNSTREAM_REMOTE_ADDRESS_WITHOUT_PORT": "remote_addr",
+	"REQUESTED_SERVER_NAME":                  "ssl_server_name",
+	"DOWNSTREAM_TLS_VERSION":                 "ssl_protocol",
+	"DOWNSTREAM_TLS_CIPHER":                  "ssl_cipher",
+}
+
+// envoyField returns the field name of a command operator.
+// For START_TIME with a format, the time layout is returned.
+func envoyField(op, arg string) (field, layout string, err error) {
+	switch op {
+	case "START_TIME":
+		if arg == "" {
+			return "time_iso8601", "", nil
+		}
+		layout, err := strftimeLayout(arg)
+		if err != nil {
+			return "", "", err
+		}
+		return "time_local", layout, nil
+	case "REQ":
+		// Alternatives are written as X?Y. The first is used.
+		h := strings.SplitN(arg, "?", 2)
+		if len(h) == 2 && strings.EqualFold(h[1], ":PATH") {
+			return "uri", "", nil
+		}
+		switch strings.ToLower(h[0]) {
+		case ":method":
+			return "method", "", nil
+		case ":path":
+			return "uri", "", nil
+		case ":authority":
+			return "host", "", nil
+		case ":scheme":
+			return "scheme", "", nil
+		case "x-envoy-upstream-service-time":
+			return "upstream_service_time", "", nil
+		}
+		return "http_" + headerName(strings.TrimPrefix(h[0], ":")), "", nil
+	case "RESP":
+		if strings.EqualFold(arg, "X-ENVOY-UPSTREAM-SERVICE-TIME") {
+			return "upstream_service_time", "", nil
+		}
+		return "sent_http_" + headerName(arg), "", nil
+	}
+	if f, ok := envoyFields[op]; ok {
+		return f, "", nil
+	}
+	return strings.ToLower(op), "", nil
+}
+
+// envoyLogFormat translates an Envoy text format string to a log format
+// and returns the time layout, if START_TIME has a format.
+func envoyLogFormat(s string) (format, layout string, err error) {
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "\n"), `\n`)
+	used := make(map[string]int)
+	var out []string
+	last := 0
+	for _, m := range envoyOperator.FindAllStringSubmatchIndex(s, -1) {
+		out = append(out, s[last:m[0]])
+		last = m[1]
+		arg := ""
+		if m[4] >= 0 {
+			arg = s[m[4]:m[5]]
+		}
+		field, l, err := envoyField(s[m[2]:m[3]], arg)
+		if err != nil {
+			return "", "", err
+		}
+		if l != "" {
+			layout = l
+		}
+		// Names must be unique. Later fields with the same name are ignored.
+		used[field]++
+		if n := used[field]; n > 1 {
+			field = fmt.Sprintf("%s_%d", field, n)
+		}
+		out = append(out, "$"+field)
+	}
+	out = append(out, s[last:])
+	return strings.Join(out, ""), layout, nil
+}
+
+// envoyJSONMapping returns the mapping of fields to JSON keys
+// of an Envoy JSON format, for example {"method":"%REQ(:METHOD)%"}.
+// Keys with values that are not a single command operator are ignored.
+func envoyJSONMapping(s string) (map[string]string, error) {
+	var obj map[string]interface{}
+	err := json.Unmarshal([]byte(s), &obj)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON format: %v", err)
+	}
+	m := make(map[string]string)
+	for key, v := range obj {
+		op, ok := v.(string)
+		if !ok {
+			continue
+		}
+		sm := envoyOperator.FindStringSubmatch(op)
+		if sm == nil || sm[0] != op {
+			continue
+		}
+		field, _, err := envoyField(sm[1], sm[2])
+		if err != nil {
+			return nil, err
+		}
+		if field == "time_local" {
+			// Formatted times cannot be parsed without a layout.
+			continue
+		}
+		m[field] = key
+	}
+	return m, nil
+}
+
+// applyEnvoyFormat will read logs written with an Envoy format.
+// The format can be the name of a built-in format, a text format
+// or a JSON format.
+func applyEnvoyFormat(s string) error {
+	set := flagsSet()
+	if set["format"] || set["preset"] || set["nginx-conf"] || set["apache-format"] || set["json"] || set["json-map"] || set["input"] {
+		return fmt.Errorf("-envoy-format cannot be used with other log format flags")
+	}
+	if f, ok := envoyFormats[s]; ok {
+		s = f
+	}
+	if strings.HasPrefix(strings.TrimSpace(s), "{") {
+		m, err := envoyJSONMapping(s)
+		if err != nil {
+			return fmt.Errorf("-envoy-format: %v", err)
+		}
+		jsonFields = m
+		return nil
+	}
+	f, layout, err := envoyLogFormat(s)
+	if err != nil {
+		return fmt.Errorf("-envoy-format: %v", err)
+	}
+	*format, formatEscape = f, ""
+	if layout != "" && !set["timeformat"] {
+		*timeFormat = layout
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEnvoyDefault(t *testing.T) {
+	format, layout, err := envoyLogFormat(envoyFormats["default"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if layout != "" {
+		t.Fatalf("unexpected layout %q", layout)
+	}
+	rec, err := mustParser(t, format, "").ParseString(`[2016-04-15T20:17:00.310Z] "POST /api/v1/locations HTTP/2" 204 UH,UF 154 0 226 100 "10.0.35.28" "nsq2http" "cc21d9b0-cf5c-432b-8c7e-98aeb7988cd2" "locations" "tcp://10.0.2.1:80"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := parseEntry(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2016, 4, 15, 20, 17, 0, 310e6, time.UTC); !req.ServerTime.Equal(want) {
+		t.Errorf("expected time %v, got %v", want, req.ServerTime)
+	}
+	if req.Method != "POST" || req.URI != "/api/v1/locations" || req.Protocol != "HTTP/2" || req.StatusCode != 204 {
+		t.Errorf("unexpected request %+v", *req)
+	}
+	if !reflect.DeepEqual(req.ResponseFlags, []string{"UH", "UF"}) || req.RequestTime != 0.226 || req.UpstreamTime != 0.1 {
+		t.Errorf("unexpected request %+v", *req)
+	}
+	if req.VirtualHost != "locations" || req.UserAgent != "nsq2http" || req.RequestID != "cc21d9b0-cf5c-432b-8c7e-98aeb7988cd2" || req.UpstreamAddr != "tcp://10.0.2.1:80" || req.ForwardedFor != "10.0.35.28" {
+		t.Errorf("unexpected request %+v", *req)
+	}
+}
+
+func TestEnvoyIstio(t *testing.T) {
+	format, _, err := envoyLogFormat(envoyFormats["istio"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := mustParser(t, format, "").ParseString(`[2020-11-25T21:26:18.409Z] "GET /status/418 HTTP/1.1" 418 - via_upstream - "-" 0 135 4 4 "-" "curl/7.73.0-DEV" "84961386-6d84-929d-98bd-c5aee93b5c88" "httpbin:8000" "127.0.0.1:80" inbound|8000|| 127.0.0.1:41854 10.44.1.27:80 10.44.1.23:37652 outbound_.8000_._.httpbin.foo.svc.cluster.local default`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := parseEntry(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Remote != "10.44.1.23" || req.Backend != "inbound|8000||" || req.StatusCode != 418 || req.ResponseFlags != nil || req.Payload != 135 {
+		t.Errorf("unexpected request %+v", *req)
+	}
+}
+
+func TestEnvoyFormats(t *testing.T) {
+	format, layout, err := envoyLogFormat(`%START_TIME(%Y/%m/%d %H:%M:%S)% %REQ(:METHOD)% %REQ(:PATH):256% %REQ(X-A)% %REQ(X-A)%\n`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != `$time_local $method $uri $http_x_a $http_x_a_2` || layout != "2006/01/02 15:04:05" {
+		t.Errorf("unexpected format %q, layout %q", format, layout)
+	}
+
+	m, err := envoyJSONMapping(`{"start":"%START_TIME%","method":"%REQ(:METHOD)%","path":"%REQ(X-ENVOY-ORIGINAL-PATH?:PATH)%","code":"%RESPONSE_CODE%","flags":"%RESPONSE_FLAGS%","cluster":"%UPSTREAM_CLUSTER%","duration":"%DURATION%","fixed":"text %PROTOCOL%"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"time_iso8601": "start", "method": "method", "uri": "path", "status": "code", "response_flags": "flags", "backend": "cluster", "request_time_ms": "duration"}
+	if !reflect.DeepEqual(m, want) {
+		t.Fatalf("got mapping %v", m)
+	}
+	rec, err := newJSONParser(m).ParseString(`{"start":"2020-11-25T21:26:18.409Z","method":"GET","path":"/a","code":503,"flags":"UF","cluster":"outbound|80||b","duration":12}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := parseEntry(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.URI != "/a" || req.StatusCode != 503 || req.Backend != "outbound|80||b" || req.RequestTime != 0.012 || !reflect.DeepEqual(req.ResponseFlags, []string{"UF"}) {
+		t.Errorf("unexpected request %+v", *req)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/InterviewAssignment/traffic"
+	"github.com/satyrius/gonx"
+)
+
+// errorLogs are parsers for web server error logs, selected with -error-log.
+// Lines are stored as error log entries instead of requests.
+var errorLogs = map[string]func() gonx.StringParser{
+	"apache": newApacheErrorParser,
+	"nginx":  newNginxErrorParser,
+}
+
+// errorLogNames returns the names of all error logs, sorted.
+func errorLogNames() []string {
+	names := make([]string, 0, len(errorLogs))
+	for name := range errorLogs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyErrorLog will select the parser for the named error log.
+// The log format flags cannot be used with an error log.
+func applyErrorLog(name string) error {
+	set := flagsSet()
+	if set["format"] || set["preset"] || set["nginx-conf"] || set["apache-format"] || set["json"] || set["json-map"] || set["input"] || set["envoy-format"] {
+		return fmt.Errorf("-error-log cannot be used with other log format flags")
+	}
+	if _, ok := errorLogs[name]; !ok {
+		return fmt.Errorf("unknown error log %q. Available error logs: %s", name, strings.Join(errorLogNames(), ", "))
+	}
+	return nil
+}
+
+// apacheErrorTime is the layout of the time of Apache error logs.
+// Apache 2.4 adds microseconds, which are accepted after the seconds.
+const apacheErrorTime = "Mon Jan 02 15:04:05 2006"
+
+// apacheErrorParser parses Apache error logs.
+type apacheErrorParser struct{}
+
+// newApacheErrorParser returns a parser for Apache 2.4 error logs with the
+// default ErrorLogFormat. Apache 2.2 lines, without module and pid, are also read.
+func newApacheErrorParser() gonx.StringParser {
+	return apacheErrorParser{}
+}
+
+// ParseString parses an Apache error log line, for example:
+//
+//	[Wed Oct 11 14:32:52.123456 2000] [core:error] [pid 35708:tid 4328636416] [client 72.15.99.187:54321] AH00124: File does not exist: /favicon.ico
+func (apacheErrorParser) ParseString(line string) (*gonx.Entry, error) {
+	ts, rest, ok := cutBracket(line)
+	if !ok {
+		return nil, fmt.Errorf("line is not an Apache error log line")
+	}
+	t, err := time.ParseInLocation(apacheErrorTime, ts, time.Local)
+	if err != nil {
+		return nil, &lineError{Kind: "time", Err: err}
+	}
+	entry := gonx.NewEmptyEntry()
+	entry.SetField("time_iso8601", t.Format(time.RFC3339Nano))
+
+	level := ""
+fields:
+	for {
+		f, r, ok := cutBracket(rest)
+		if !ok {
+			break
+		}
+		switch {
+		case strings.HasPrefix(f, "pid "):
+			pid, tid := f[len("pid "):], ""
+			if i := strings.Index(pid, ":tid "); i >= 0 {
+				pid, tid = pid[:i], pid[i+len(":tid "):]
+			}
+			entry.SetField("pid", pid)
+			if tid != "" {
+				entry.SetField("tid", tid)
+			}
+		case strings.HasPrefix(f, "client "):
+			entry.SetField("client", f[len("client "):])
+		case strings.HasPrefix(f, "remote "):
+			// The peer of a proxied connection. The client is kept.
+		case level == "":
+			// The module and the level, for example "core:error", or only the level.
+			level = f
+			if i := strings.IndexByte(f, ':'); i >= 0 {
+				entry.SetField("module", f[:i])
+				level = f[i+1:]
+			}
+			entry.SetField("level", level)
+		default:
+			break fields
+		}
+		rest = r
+	}
+	if level == "" {
+		return nil, fmt.Errorf("no level in Apache error log line")
+	}
+
+	// With an OS error the client follows the error, for example
+	// "(70007)The timeout specified has expired: [client 1.2.3.4:5678] AH01075: ...".
+	if i := strings.Index(rest, "[client "); i >= 0 {
+		if f, r, ok := cutBracket(rest[i:]); ok {
+			entry.SetField("client", f[len("client "):])
+			rest = rest[:i] + r
+		}
+	}
+	entry.SetField("message", rest)
+	return entry, nil
+}
+
+// cutBracket returns the value of the bracketed field at the start of s,
+// and the rest of s after the following spaces.
+// Fields may contain brackets, like IPv6 addresses with a port.
+func cutBracket(s string) (field, rest string, ok bool) {
+	if !strings.HasPrefix(s, "[") {
+		return "", s, false
+	}
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				return s[1:i], strings.TrimLeft(s[i+1:], " "), true
+			}
+		}
+	}
+	return "", s, false
+}
+
+// nginxErrorLine matches nginx error log lines, with the time, level,
+// pid, tid, an optional connection number and the message.
+var nginxErrorLine = regexp.MustCompile(`^(\d{4}/\d\d/\d\d \d\d:\d\d:\d\d) \[([a-z]+)\] (\d+)#(\d+): (?:\*(\d+) )?(.*)$`)
+
+// nginxErrorTime is the layout of the time of nginx error logs.
+// The time is the local time without a time zone.
+const nginxErrorTime = "2006/01/02 15:04:05"
+
+// nginxErrorParser parses nginx error logs.
+type nginxErrorParser struct{}
+
+// newNginxErrorParser returns a parser for nginx error logs.
+func newNginxErrorParser() gonx.StringParser {
+	return nginxErrorParser{}
+}
+
+// ParseString parses an nginx error log line, for example:
+//
+//	2016/09/13 11:08:03 [error] 1043#1043: *1 open() "/usr/share/nginx/html/x" failed (2: No such file or directory), client: 10.0.0.1, server: localhost, request: "GET /x HTTP/1.1"
+func (nginxErrorParser) ParseString(line string) (*gonx.Entry, error) {
+	m := nginxErrorLine.FindStringSubmatch(line)
+	if m == nil {
+		return nil, fmt.Errorf("line is not an nginx error log line")
+	}
+	t, err := time.ParseInLocation(nginxErrorTime, m[1], time.Local)
+	if err != nil {
+		return nil, &lineError{Kind: "time", Err: err}
+	}
+	entry := gonx.NewEmptyEntry()
+	entry.SetField("time_iso8601", t.Format(time.RFC3339Nano))
+	entry.SetField("level", m[2])
+	entry.SetField("pid", m[3])
+	entry.SetField("tid", m[4])
+	entry.SetField("connection", m[5])
+	entry.SetField("message", m[6])
+
+	// The context of the request is appended to the message,
+	// for example ", client: 10.0.0.1, server: localhost".
+	if i := strings.Index(m[6], ", client: "); i >= 0 {
+		client := m[6][i+len(", client: "):]
+		if j := strings.IndexByte(client, ','); j >= 0 {
+			client = client[:j]
+		}
+		entry.SetField("client", client)
+	}
+	return entry, nil
+}
+
+// parseErrorEntry converts an entry of an error log to an ErrorEntry.
+func parseErrorEntry(rec *gonx.Entry) (*traffic.ErrorEntry, error) {
+	var e traffic.ErrorEntry
+	e.Level = optField(rec, "level")
+	e.Module = optField(rec, "module")
+	e.Message, _ = rec.Field("message")
+	if c := optField(rec, "client"); c != "" {
+		e.Client = hostOnly(c)
+	}
+
+	f, err := rec.Field("time_iso8601")
+	if err == nil {
+		e.Time, err = time.Parse(time.RFC3339, f)
+		if err != nil {
+			return nil, &lineError{Kind: "time_iso8601", Err: err}
+		}
+	}
+	if f := optField(rec, "pid"); f != "" {
+		e.PID, err = strconv.Atoi(f)
+		if err != nil {
+			return nil, &lineError{Kind: "pid", Err: err}
+		}
+	}
+	if f := optField(rec, "tid"); f != "" {
+		e.TID, err = strconv.ParseInt(f, 10, 64)
+		if err != nil {
+			return nil, &lineError{Kind: "tid", Err: err}
+		}
+	}
+	return &e, nil
+}
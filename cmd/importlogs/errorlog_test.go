@@ -0,0 +1,130 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/klauspost/InterviewAssignment/traffic"
+)
+
+// parseErrorLog parses a line of the named error log.
+func parseErrorLog(t *testing.T, name, line string) *traffic.ErrorEntry {
+	rec, err := errorLogs[name]().ParseString(line)
+	if err != nil {
+		t.Fatalf("%q: %v", line, err)
+	}
+	e, err := parseErrorEntry(rec)
+	if err != nil {
+		t.Fatalf("%q: %v", line, err)
+	}
+	return e
+}
+
+func TestApacheErrorLog(t *testing.T) {
+	e := parseErrorLog(t, "apache", `[Wed Oct 11 14:32:52.123456 2000] [core:error] [pid 35708:tid 4328636416] [client 72.15.99.187:54321] AH00124: File does not exist: /usr/local/apache2/htdocs/favicon.ico`)
+	want := traffic.ErrorEntry{
+		Time:    time.Date(2000, 10, 11, 14, 32, 52, 123456e3, time.Local),
+		Level:   "error",
+		Module:  "core",
+		PID:     35708,
+		TID:     4328636416,
+		Client:  "72.15.99.187",
+		Message: "AH00124: File does not exist: /usr/local/apache2/htdocs/favicon.ico",
+	}
+	if !e.Time.Equal(want.Time) {
+		t.Errorf("expected time %v, got %v", want.Time, e.Time)
+	}
+	e.Time = want.Time
+	if *e != want {
+		t.Errorf("got %+v, want %+v", *e, want)
+	}
+
+	// Apache 2.2 has no module, pid or microseconds.
+	e = parseErrorLog(t, "apache", `[Sun Dec 04 04:47:44 2005] [error] [client 192.168.2.1] Directory index forbidden by rule: /home/test/`)
+	if e.Level != "error" || e.Module != "" || e.PID != 0 || e.Client != "192.168.2.1" || e.Message != "Directory index forbidden by rule: /home/test/" {
+		t.Errorf("unexpected entry %+v", *e)
+	}
+
+	// The client follows an OS error.
+	e = parseErrorLog(t, "apache", `[Thu May 12 08:28:57.652118 2011] [proxy_http:error] [pid 8777:tid 4326490112] (70007)The timeout specified has expired: [client [2001:db8::1]:56234] AH01102: error reading status line from remote server localhost:8080`)
+	if e.Module != "proxy_http" || e.Client != "2001:db8::1" || e.Message != "(70007)The timeout specified has expired: AH01102: error reading status line from remote server localhost:8080" {
+		t.Errorf("unexpected entry %+v", *e)
+	}
+
+	// Lines without a client.
+	e = parseErrorLog(t, "apache", `[Mon Jan 02 10:00:00.000001 2017] [mpm_event:notice] [pid 1:tid 140] AH00489: Apache/2.4.25 (Unix) configured -- resuming normal operations`)
+	if e.Level != "notice" || e.Module != "mpm_event" || e.Client != "" || e.PID != 1 || e.TID != 140 {
+		t.Errorf("unexpected entry %+v", *e)
+	}
+
+	for _, line := range []string{
+		`127.0.0.1 - - [Wed Oct 11 14:32:52 2000] "GET / HTTP/1.0" 200 2326`,
+		`[Wed Oct 11 14:32:52 2000] AH00124: no level`,
+		`[yesterday] [core:error] message`,
+	} {
+		_, err := errorLogs["apache"]().ParseString(line)
+		if err == nil {
+			t.Errorf("expected error on %q", line)
+		}
+	}
+}
+
+func TestNginxErrorLog(t *testing.T) {
+	e := parseErrorLog(t, "nginx", `2016/09/13 11:08:03 [error] 1043#1044: *17 open() "/usr/share/nginx/html/x" failed (2: No such file or directory), client: 10.0.0.1, server: localhost, request: "GET /x HTTP/1.1", host: "example.com"`)
+	want := traffic.ErrorEntry{
+		Time:    time.Date(2016, 9, 13, 11, 8, 3, 0, time.Local),
+		Level:   "error",
+		PID:     1043,
+		TID:     1044,
+		Client:  "10.0.0.1",
+		Message: `open() "/usr/share/nginx/html/x" failed (2: No such file or directory), client: 10.0.0.1, server: localhost, request: "GET /x HTTP/1.1", host: "example.com"`,
+	}
+	if !e.Time.Equal(want.Time) {
+		t.Errorf("expected time %v, got %v", want.Time, e.Time)
+	}
+	e.Time = want.Time
+	if *e != want {
+		t.Errorf("got %+v, want %+v", *e, want)
+	}
+
+	// Messages without a connection.
+	e = parseErrorLog(t, "nginx", `2016/09/13 11:08:00 [notice] 1042#0: signal process started`)
+	if e.Level != "notice" || e.PID != 1042 || e.TID != 0 || e.Client != "" || e.Message != "signal process started" {
+		t.Errorf("unexpected entry %+v", *e)
+	}
+
+	_, err := errorLogs["nginx"]().ParseString(`10.0.0.1 - - [13/Sep/2016:11:08:03 +0000] "GET /x HTTP/1.1" 404 153`)
+	if err == nil {
+		t.Error("expected error on access log line")
+	}
+}
+
+// Tests that error logs are imported as error log entries.
+func TestImportErrorLog(t *testing.T) {
+	logOut = ioutil.Discard
+	defer func() { *errorLog = "" }()
+	*errorLog = "nginx"
+
+	dir, err := ioutil.TempDir("", "importlogs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := writeLog(t, dir, `2016/09/13 11:08:00 [notice] 1042#0: signal process started
+2016/09/13 11:08:03 [error] 1043#1043: *17 upstream timed out (110: Connection timed out), client: 10.0.0.1, server: localhost
+`)
+	store := &memStore{}
+	err = importFile(name, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(store.reqs) != 0 || len(store.errs) != 2 {
+		t.Fatalf("expected 2 error log entries, got %d requests and %d entries", len(store.reqs), len(store.errs))
+	}
+	e := store.errs[1]
+	if e.Level != "error" || e.Client != "10.0.0.1" || e.ID == "" || e.ID == store.errs[0].ID {
+		t.Errorf("unexpected entry %+v", e)
+	}
+}
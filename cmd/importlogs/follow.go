@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"time"
+
+	"github.com/klauspost/InterviewAssignment/traffic"
+)
+
+// tail reads complete lines from a plain text file that is being written to.
+//
+// Rotation is detected by comparing the identity (inode) of the file at the
+// path with the file we have open, and by comparing the size of the open file
+// with the number of bytes we have read.
+//
+//   - rename/delaycompress: the path points to a new file. The old file is read
+//     to the end and the new file is read from the beginning.
+//   - copytruncate: the open file is smaller than our offset.
+//     The file is read from the beginning.
+type tail struct {
+	path    string
+	f       *os.File
+	id      os.FileInfo // Identity of the open file.
+	r       *bufio.Reader
+	offset  int64  // Bytes consumed from the open file.
+	partial string // Incomplete last line.
+}
+
+// openTail opens the file at the path for tailing.
+func openTail(path string) (*tail, error) {
+	t := &tail{path: path}
+	return t, t.open()
+}
+
+// open (re)opens the file at the path and starts reading from the beginning.
+func (t *tail) open() error {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	id, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if t.f != nil {
+		t.f.Close()
+	}
+	t.f, t.id = f, id
+	t.r = bufio.NewReader(f)
+	t.offset = 0
+	t.partial = ""
+	return nil
+}
+
+// readLines will send all complete lines currently in the file to fn.
+// A trailing line without a line feed is kept until it is completed.
+func (t *tail) readLines(fn func(line string) error) error {
+	for {
+		line, err := t.r.ReadString('\n')
+		t.offset += int64(len(line))
+		if err == io.EOF {
+			t.partial += line
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		err = fn(t.partial + line)
+		t.partial = ""
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// rotated checks if the file has been rotated.
+// If so, the remaining content of the old file is sent to fn,
+// and the file at the path must be opened again with open.
+func (t *tail) rotated(fn func(line string) error) (bool, error) {
+	cur, err := os.Stat(t.path)
+	if os.IsNotExist(err) {
+		// Renamed, but the new file hasn't been created yet.
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !os.SameFile(cur, t.id) {
+		// Read what was written to the old file after our last read.
+		err = t.readLines(fn)
+		if err != nil {
+			return false, err
+		}
+		// The old file will not be completed, so send the last line as is.
+		if t.partial != "" {
+			err = fn(t.partial)
+			if err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+	st, err := t.f.Stat()
+	if err != nil {
+		return false, err
+	}
+	if st.Size() < t.offset {
+		// Truncated.
+		return true, nil
+	}
+	return false, nil
+}
+
+// seek will continue reading the open file at the offset.
+func (t *tail) seek(offset int64) error {
+	_, err := t.f.Seek(offset, os.SEEK_SET)
+	if err != nil {
+		return err
+	}
+	t.r.Reset(t.f)
+	t.offset = offset
+	t.partial = ""
+	return nil
+}
+
+// Close the open file.
+func (t *tail) Close() error {
+	return t.f.Close()
+}
+
+// followFile will import a plain text file from the beginning, and continue
+// to import lines as they are appended to the file until stop is closed.
+// Rotated files are detected and followed to the new file.
+func followFile(file string, store traffic.RequestStore, stop <-chan struct{}) error {
+	t, err := openTail(file)
+	if err != nil {
+		return err
+	}
+	defer t.Close()
+
+	f := newFileImport(file, store)
+	err = followLines(t, f, stop)
+	if ferr := f.finish(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+// followLines will import lines from the tailed file until stop is closed.
+func followLines(t *tail, f *fileImport, stop <-chan struct{}) error {
+	// Resume the file that is currently open from its checkpoint.
+	resume := func() error {
+		offset, err := f.resume(t.f)
+		if err != nil {
+			return err
+		}
+		if offset > 0 && f.replay() {
+			err = f.skipLines(bufio.NewReader(io.NewSectionReader(t.f, 0, offset)), offset)
+			if err != nil {
+				return err
+			}
+		}
+		return t.seek(offset)
+	}
+	err := resume()
+	if err != nil {
+		return err
+	}
+	for {
+		err := t.readLines(f.importLine)
+		if err != nil {
+			return err
+		}
+		rotated, err := t.rotated(f.importLine)
+		if err != nil {
+			return err
+		}
+		if rotated {
+			// Save the checkpoint of the old file before the new file is opened.
+			err = f.commit()
+			if err != nil {
+				return err
+			}
+			err = t.open()
+			if err != nil {
+				return err
+			}
+			err = resume()
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		select {
+		case <-stop:
+			return nil
+		case <-time.After(*pollInterval):
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// logLine returns a log line in the default format requesting the uri.
+func logLine(uri string) string {
+	return fmt.Sprintf("127.0.0.1 - - [28/Jul/1995:13:26:37 -0400] \"GET %s HTTP/1.0\" 200 100\n", uri)
+}
+
+// appendFile appends lines to a file, creating it if needed.
+func appendFile(t *testing.T, name string, lines ...string) {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for _, l := range lines {
+		_, err := f.WriteString(l)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// waitURIs waits until the store contains the expected URIs.
+func waitURIs(t *testing.T, store *memStore, want ...string) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if reflect.DeepEqual(store.URIs(), want) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expected %v, got %v", want, store.URIs())
+}
+
+// Tests that appended lines are imported and that rename and
+// copytruncate rotation are followed. The checkpoint of the old
+// file must be saved when the file is rotated.
+func TestFollow(t *testing.T) {
+	logOut = ioutil.Discard
+	defer func(d time.Duration) { *pollInterval = d }(*pollInterval)
+	*pollInterval = 10 * time.Millisecond
+	defer func(d time.Duration) { *checkpointInterval = d }(*checkpointInterval)
+	*checkpointInterval = time.Hour
+
+	dir, err := ioutil.TempDir("", "importlogs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "access.log")
+	appendFile(t, name, logLine("/a"))
+	defer func() { state = nil }()
+	stateName := filepath.Join(dir, "state.json")
+	state, err = loadCheckpoints(stateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := &memStore{}
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- followFile(name, store, stop)
+	}()
+	waitURIs(t, store, "/a")
+
+	// A partial line must not be imported before it is completed.
+	line := logLine("/b")
+	appendFile(t, name, line[:10])
+	time.Sleep(50 * time.Millisecond)
+	waitURIs(t, store, "/a")
+	appendFile(t, name, line[10:])
+	waitURIs(t, store, "/a", "/b")
+
+	// Rename rotation. The line written to the old file after
+	// the rename must still be imported.
+	err = os.Rename(name, name+".1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, name+".1", logLine("/c"))
+	appendFile(t, name, logLine("/d"))
+	waitURIs(t, store, "/a", "/b", "/c", "/d")
+	saved, err := loadCheckpoints(stateName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, err := os.Stat(name + ".1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp := saved.files[name]
+	if cp.Inode != fileInode(st) || cp.Offset != st.Size() || cp.Lines != 3 {
+		t.Fatalf("unexpected checkpoint of rotated file %+v, want offset %d after 3 lines", cp, st.Size())
+	}
+
+	// Copytruncate rotation.
+	err = os.Truncate(name, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	appendFile(t, name, logLine("/e"))
+	waitURIs(t, store, "/a", "/b", "/c", "/d", "/e")
+
+	close(stop)
+	err = <-done
+	if err != nil {
+		t.Fatal(err)
+	}
+}
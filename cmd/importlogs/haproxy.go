@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/InterviewAssignment/traffic"
+	"github.com/satyrius/gonx"
+)
+
+// haproxyLine matches the fields of a line written with "option httplog".
+// Anything before the client address, like the syslog header, is ignored.
+// See http://cbonte.github.io/haproxy-dconv/1.8/configuration.html#8.2.3
+var haproxyLine = regexp.MustCompile(`(\S+):(\d+) \[([^\]]+)\] (\S+) ([^ /]+)/(\S+) ` +
+	`(-?\d+)/(-?\d+)/(-?\d+)/(-?\d+)/\+?(-?\d+) (-?\d+) \+?(\d+) (\S+) (\S+) (\S{4}) ` +
+	`(\d+)/(\d+)/(\d+)/(\d+)/\+?(\d+) (\d+)/(\d+) (?:\{[^}]*\} ){0,2}"(.*)"$`)
+
+// haproxyFields are the field names of the submatches of haproxyLine.
+var haproxyFields = []string{
+	"remote_addr", "remote_port", "accept_date", "frontend", "backend", "backend_server",
+	"time_request", "time_queue", "time_connect", "time_response", "time_active",
+	"status", "size", "request_cookie", "response_cookie", "termination_state",
+	"actconn", "feconn", "beconn", "srv_conn", "retries", "srv_queue", "backend_queue",
+	"request",
+}
+
+// haproxyTime is the layout of the accept date.
+// HAProxy logs the local time without a time zone.
+const haproxyTime = "02/Jan/2006:15:04:05.000"
+
+// haproxyParser parses HAProxy HTTP logs.
+type haproxyParser struct{}
+
+// newHAProxyParser returns a parser for HAProxy logs written with "option httplog".
+func newHAProxyParser() gonx.StringParser {
+	return haproxyParser{}
+}
+
+// ParseString parses a HAProxy log line.
+func (haproxyParser) ParseString(line string) (*gonx.Entry, error) {
+	m := haproxyLine.FindStringSubmatch(line)
+	if m == nil {
+		return nil, fmt.Errorf("line is not a HAProxy HTTP log line")
+	}
+	entry := gonx.NewEmptyEntry()
+	for i, name := range haproxyFields {
+		entry.SetField(name, m[i+1])
+	}
+	t, err := time.ParseInLocation(haproxyTime, m[3], time.Local)
+	if err != nil {
+		return nil, &lineError{Kind: "accept_date", Err: err}
+	}
+	entry.SetField("time_iso8601", t.Format(time.RFC3339Nano))
+
+	// The total active time and the server response time. -1 if not reached.
+	if ta := m[11]; ta != "-1" {
+		entry.SetField("request_time_ms", ta)
+	}
+	if tr := m[10]; tr != "-1" {
+		ms, _ := strconv.Atoi(tr)
+		entry.SetField("upstream_response_time", strconv.FormatFloat(float64(ms)/1000, 'f', -1, 64))
+	}
+	return entry, nil
+}
+
+// parseHAProxy returns the HAProxy fields of an entry.
+// If the entry has no termination state, nil is returned.
+func parseHAProxy(rec *gonx.Entry) (*traffic.HAProxy, error) {
+	state, err := rec.Field("termination_state")
+	if err != nil {
+		return nil, nil
+	}
+	h := traffic.HAProxy{TerminationState: state}
+	for _, f := range []struct {
+		name string
+		dst  *int
+	}{
+		{"time_request", &h.RequestTime},
+		{"time_queue", &h.QueueTime},
+		{"time_connect", &h.ConnectTime},
+		{"time_response", &h.ResponseTime},
+		{"time_active", &h.ActiveTime},
+		{"actconn", &h.ActiveConns},
+		{"feconn", &h.FrontendConns},
+		{"beconn", &h.BackendConns},
+		{"srv_conn", &h.ServerConns},
+		{"retries", &h.Retries},
+		{"srv_queue", &h.ServerQueue},
+		{"backend_queue", &h.BackendQueue},
+	} {
+		v, err := rec.Field(f.name)
+		if err != nil {
+			continue
+		}
+		*f.dst, err = strconv.Atoi(strings.TrimPrefix(v, "+"))
+		if err != nil {
+			return nil, &lineError{Kind: f.name, Err: err}
+		}
+	}
+	return &h, nil
+}
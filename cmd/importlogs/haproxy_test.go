@@ -0,0 +1,52 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/klauspost/InterviewAssignment/traffic"
+)
+
+func TestHAProxy(t *testing.T) {
+	req := parseInput(t, "haproxy", `Feb  6 12:14:14 localhost haproxy[14389]: 10.0.1.2:33317 [06/Feb/2009:12:14:14.655] http-in static/srv1 10/0/30/69/109 200 2750 - - ---- 1/1/1/1/0 0/0 {1wt.eu} {} "GET /index.html HTTP/1.1"`)
+	if want := time.Date(2009, 2, 6, 12, 14, 14, 655e6, time.Local); !req.ServerTime.Equal(want) {
+		t.Errorf("expected time %v, got %v", want, req.ServerTime)
+	}
+	if req.Remote != "10.0.1.2" || req.Method != "GET" || req.URI != "/index.html" || req.StatusCode != 200 || req.Payload != 2750 {
+		t.Errorf("unexpected request %+v", *req)
+	}
+	if req.Frontend != "http-in" || req.Backend != "static" || req.Server != "srv1" || req.RequestTime != 0.109 || req.UpstreamTime != 0.069 {
+		t.Errorf("unexpected request %+v", *req)
+	}
+	want := &traffic.HAProxy{
+		TerminationState: "----",
+		RequestTime:      10,
+		QueueTime:        0,
+		ConnectTime:      30,
+		ResponseTime:     69,
+		ActiveTime:       109,
+		ActiveConns:      1,
+		FrontendConns:    1,
+		BackendConns:     1,
+		ServerConns:      1,
+	}
+	if !reflect.DeepEqual(req.HAProxy, want) {
+		t.Errorf("got %+v, want %+v", req.HAProxy, want)
+	}
+
+	// An aborted request without a server, written without syslog header.
+	req = parseInput(t, "haproxy", `10.0.1.2:33318 [06/Feb/2009:12:14:15.001] http-in~ www/<NOSRV> -1/-1/-1/-1/+5002 408 +212 - - cR-- 2/2/0/0/+3 0/0 "<BADREQ>"`)
+	if req.StatusCode != 408 || req.Payload != 212 || !req.Malformed || req.UpstreamTime != 0 || req.RequestTime != 5.002 {
+		t.Errorf("unexpected request %+v", *req)
+	}
+	if req.HAProxy.TerminationState != "cR--" || req.HAProxy.ResponseTime != -1 || req.HAProxy.Retries != 3 {
+		t.Errorf("unexpected HAProxy fields %+v", req.HAProxy)
+	}
+
+	// TCP logs are not HTTP logs.
+	_, err := inputs["haproxy"]().ParseString(`10.0.1.2:33319 [06/Feb/2009:12:14:16.001] tcp-in app/srv1 0/0/5007 212 -- 0/0/0/0/3 0/0`)
+	if err == nil {
+		t.Error("expected error on TCP log line")
+	}
+}
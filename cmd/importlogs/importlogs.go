@@ -12,12 +12,16 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"os/signal"
+	"runtime"
 	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/klauspost/InterviewAssignment/decompress"
 	"github.com/klauspost/InterviewAssignment/traffic"
-	"github.com/klauspost/pgzip"
 	"github.com/oschwald/geoip2-golang"
 	"github.com/satyrius/gonx"
 )
@@ -25,25 +29,62 @@ import (
 // Executable flags.
 // See doc.go for more details.
 var (
-	format        = flag.String("format", `$remote_addr - - [$time_local] "$method $uri $protocol" $status $size`, "Log format")
-	timeFormat    = flag.String("timeformat", `02/Jan/2006:15:04:05 -0700`, "Time format in Go time.Parse format.")
+	format        = flag.String("format", presets["nasa"].format, "Log format")
+	timeFormat    = flag.String("timeformat", presets["nasa"].timeFormat, "Time format in Go time.Parse format.")
+	presetName    = flag.String("preset", "", "named log format: combined, common, nasa, nginx or vhost_combined")
+	apacheFormat  = flag.String("apache-format", "", "Apache LogFormat string describing the log format")
+	inputName     = flag.String("input", "", "read logs of a format declared in the file: w3c")
+	jsonName      = flag.String("json", "", "read JSON lines with a built-in mapping: caddy, nginx or traefik")
+	jsonMap       = flag.String("json-map", "", "read JSON lines, mapping fields to JSON keys: field=key,...")
+	envoyFormat   = flag.String("envoy-format", "", "Envoy access log format: default, istio, or a text or JSON format")
+	errorLog      = flag.String("error-log", "", "read error logs instead of access logs: apache or nginx")
+	container     = flag.String("container", "", "unwrap lines written by a container runtime: docker or cri")
+	containerMeta = flag.Bool("container-meta", false, "add container metadata from the path of the file to each line")
+	nginxConf     = flag.String("nginx-conf", "", "read the log format from an nginx configuration file")
+	nginxName     = flag.String("nginx-format", "main", "name of the log_format in the -nginx-conf file")
 	continueError = flag.Bool("e", false, "continue to next file if an error occurs")
 	elasticHost   = flag.String("elastic", "http://127.0.0.1:9200", "url to elasticseach server (http)")
 	clean         = flag.Bool("clean", false, "clean the index before adding content")
 	test          = flag.Bool("test", false, "write json representation of requests to stdout")
 	geoDB         = flag.String("geodb", "", "MaxMind GeoLite2 or GeoIP2 mmdb database to translate IP to location")
+	follow        = flag.Bool("follow", false, "follow plain text log files as they grow, handling rotation")
+	pollInterval  = flag.Duration("poll", time.Second, "interval between checks for new data in follow mode")
+	stateFile     = flag.String("checkpoint", "", "state file used to resume interrupted imports")
+	salvage       = flag.Bool("salvage", false, "import what can be decoded from truncated or corrupted gzip files")
+	onError       = flag.String("on-error", policyAbort, "policy for lines that cannot be parsed: abort, skip or deadletter")
+	deadLetterOut = flag.String("deadletter", "", "NDJSON file receiving rejected lines with -on-error=deadletter")
+	workers       = flag.Int("workers", runtime.NumCPU(), "number of goroutines parsing and enriching lines of each file")
+	queueDepth    = flag.Int("queue", 1000, "number of lines queued for parsing and storing in each file")
+	filesParallel = flag.Int("files-parallel", 1, "number of files imported at the same time")
+
+	checkpointInterval = flag.Duration("checkpoint-interval", 10*time.Second, "interval between saved checkpoints")
+
+	s3Endpoint      = flag.String("s3-endpoint", "", "endpoint of S3 compatible storage. Default is AWS S3 in the -s3-region")
+	s3Region        = flag.String("s3-region", "", "region used to sign S3 requests. Default is $AWS_REGION or us-east-1")
+	downloadRetries = flag.Int("download-retries", 5, "number of attempts to resume an interrupted download")
 )
 
 // Local variables.
 var (
 	exitCode = 0                    // Exitcode. Used if 'continueError' is set.
+	exitMu   sync.Mutex             // Protects exitCode and error reporting.
 	logOut   = io.Writer(os.Stdout) // Write progress to this writer.
+	state    *checkpoints           // Checkpoints of imported files. nil if not used.
+	rejected *deadLetterWriter      // Receives rejected lines. nil if not used.
+
+	formatEscape string            // Escaping of values in the log format. See newParser.
+	jsonFields   map[string]string // Mapping of fields to JSON keys. nil if not reading JSON.
 )
 
 // Print usage help and exit with exit code 2
 func usage() {
 	fmt.Fprintln(os.Stderr, "usage: importlogs [flags] file1.gz [file2.gz...]")
-	fmt.Fprintln(os.Stderr, "\tImports gzipped log files.")
+	fmt.Fprintln(os.Stderr, "\tImports log files. gzip, bzip2 and zlib compression is detected.")
+	fmt.Fprintln(os.Stderr, "\tUse - to import from stdin. http://, https:// and s3://bucket/prefix arguments import remote objects.")
+	fmt.Fprintln(os.Stderr, "       importlogs -follow [flags] file1.log [file2.log...]")
+	fmt.Fprintln(os.Stderr, "\tImports plain text log files and follows them as they grow.")
+	fmt.Fprintln(os.Stderr, "       importlogs [flags] listen [udp://host:port] [tcp://host:port] [http://host:port/path...]")
+	fmt.Fprintln(os.Stderr, "\tImports log lines received as syslog messages or pushed over HTTP.")
 	fmt.Fprintln(os.Stderr, "flags:")
 	flag.PrintDefaults()
 	os.Exit(2)
@@ -57,6 +98,34 @@ func main() {
 		usage()
 	}
 
+	if *presetName != "" {
+		failOnErr(applyPreset(*presetName))
+	}
+	if *nginxConf != "" {
+		failOnErr(applyNginxConf(*nginxConf, *nginxName))
+	}
+	if *apacheFormat != "" {
+		failOnErr(applyApacheFormat(*apacheFormat))
+	}
+	if *jsonName != "" || *jsonMap != "" {
+		failOnErr(applyJSON(*jsonName, *jsonMap))
+	}
+	if *inputName != "" {
+		failOnErr(applyInput(*inputName))
+	}
+	if *envoyFormat != "" {
+		failOnErr(applyEnvoyFormat(*envoyFormat))
+	}
+	if *errorLog != "" {
+		failOnErr(applyErrorLog(*errorLog))
+	}
+	if *container != "" {
+		failOnErr(applyContainer(*container))
+	}
+	if _, err := newParser(*format, formatEscape); err != nil {
+		failOnErr(err)
+	}
+
 	// If testing, redirect logging
 	if *test {
 		logOut = ioutil.Discard
@@ -90,9 +159,17 @@ func main() {
 		failOnErr(err)
 	} else {
 		// Create an elasticsearch storer.
-		store, err = traffic.NewElastic(*elasticHost, "requests")
+		// Error log entries are stored in their own indexes.
+		index := "requests"
+		if *errorLog != "" {
+			index = traffic.ErrorIndex
+		}
+		store, err = traffic.NewElastic(*elasticHost, index)
 		failOnErr(err)
 	}
+	if _, ok := store.(traffic.ErrorStore); *errorLog != "" && !ok {
+		failOnErr(fmt.Errorf("the store cannot store error log entries"))
+	}
 
 	// Be sure we close the store and return the proper exitcode
 	defer func() {
@@ -106,19 +183,81 @@ func main() {
 		failOnErr(err)
 	}
 
+	// Open the dead-letter file
+	switch *onError {
+	case policyAbort, policySkip:
+	case policyDeadLetter:
+		if *deadLetterOut == "" {
+			failOnErr(fmt.Errorf("-on-error=deadletter requires -deadletter"))
+		}
+		f, err := os.OpenFile(*deadLetterOut, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+		failOnErr(err)
+		defer f.Close()
+		rejected = &deadLetterWriter{out: f}
+	default:
+		failOnErr(fmt.Errorf("unknown -on-error policy %q", *onError))
+	}
+
+	// Load checkpoints
+	if *stateFile != "" {
+		state, err = loadCheckpoints(*stateFile)
+		failOnErr(err)
+	}
+
 	// Clean the database if requested
 	if *clean {
 		err := store.RemoveAll()
 		failOnErr(err)
 	}
 
-	// Open all input files
-	for _, file := range args {
-		err := importFile(file, store)
-		if err != nil {
-			report(file, err)
+	// Receive syslog messages until we are interrupted.
+	if args[0] == "listen" {
+		listen(args[1:], store)
+		return
+	}
+
+	// Follow all files until we are interrupted.
+	if *follow {
+		for _, file := range args {
+			if isRemote(file) {
+				failOnErr(fmt.Errorf("%s: remote objects cannot be followed", file))
+			}
 		}
+		followFiles(args, store)
+		return
 	}
+
+	// Import all input files
+	importFiles(expandS3(args), store)
+}
+
+// importFiles will import all files to the store,
+// importing up to -files-parallel files at the time.
+// Errors are reported for each file.
+func importFiles(files []string, store traffic.RequestStore) {
+	n := *filesParallel
+	if n < 1 {
+		n = 1
+	}
+	queue := make(chan string)
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+			for file := range queue {
+				err := importFile(file, store)
+				if err != nil {
+					report(file, err)
+				}
+			}
+		}()
+	}
+	for _, file := range files {
+		queue <- file
+	}
+	close(queue)
+	wg.Wait()
 }
 
 // Report an error and always fail
@@ -132,6 +271,8 @@ func failOnErr(err error) {
 
 // Report an error, and exit depending on the 'continueError'
 func report(file string, err error) {
+	exitMu.Lock()
+	defer exitMu.Unlock()
 	if file == "" {
 		fmt.Fprintln(os.Stderr, err)
 	} else {
@@ -145,67 +286,597 @@ func report(file string, err error) {
 	exitCode = 2
 }
 
+// followFiles will follow all files concurrently until
+// the process receives an interrupt or a termination signal.
+func followFiles(files []string, store traffic.RequestStore) {
+	stop := make(chan struct{})
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		log.Println("Stopping, waiting for pending lines.")
+		close(stop)
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(len(files))
+	for _, file := range files {
+		go func(file string) {
+			defer wg.Done()
+			err := followFile(file, store, stop)
+			if err != nil {
+				report(file, err)
+			}
+		}(file)
+	}
+	wg.Wait()
+	signal.Stop(sig)
+}
+
 // importFile will Import a single file.
-// The file is assumed to be gzipped.
+// Compression is detected automatically.
+// If the file is "-", stdin is imported.
 func importFile(file string, store traffic.RequestStore) error {
+	if isRemote(file) {
+		return importRemote(file, store)
+	}
+
 	// Open file
-	fi, err := os.Open(file)
+	fi := os.Stdin
+	if file != "-" {
+		var err error
+		fi, err = os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer fi.Close()
+	}
+
+	// Find where to resume the import
+	f := newFileImport(file, store)
+	offset, err := f.resume(fi)
 	if err != nil {
 		return err
 	}
-	defer fi.Close()
 
-	// Unzip the input stream
-	br := bufio.NewReader(fi)
-	gr, err := pgzip.NewReader(br)
+	// Decompress the input stream
+	var r io.ReadCloser
+	var compression string
+	var sr *decompress.SalvageReader
+	if *salvage && file != "-" {
+		sr, err = newSalvageReader(fi)
+		if err != nil {
+			return err
+		}
+		if sr != nil {
+			r, compression = sr, "gzip"
+			defer reportSalvage(file, sr)
+		}
+	}
+	if r == nil {
+		r, compression, err = decompress.NewReader(fi)
+		if err != nil {
+			return err
+		}
+	}
+	defer r.Close()
+
+	// Skip the content that has already been stored.
+	// If the format is declared in the file, or lines are joined,
+	// the skipped lines must be read.
+	seek := offset > 0 && compression == "" && !f.replay()
+	if seek {
+		_, err = fi.Seek(offset, os.SEEK_SET)
+		if err != nil {
+			return err
+		}
+		r = fi
+	}
+	br := bufio.NewReader(r)
+	if offset > 0 && !seek {
+		err = f.skipLines(br, offset)
+		if err != nil {
+			return fmt.Errorf("resuming at offset %d: %v", offset, err)
+		}
+	}
+
+	err = f.importLines(br)
+	if ferr := f.finish(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+// newSalvageReader returns a reader that skips damaged data,
+// if the file is gzipped. Otherwise nil is returned.
+func newSalvageReader(fi *os.File) (*decompress.SalvageReader, error) {
+	st, err := fi.Stat()
+	if err != nil {
+		return nil, err
+	}
+	head := make([]byte, 4)
+	n, err := fi.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if name, _, _ := decompress.Detect(head[:n]); name != "gzip" {
+		return nil, nil
+	}
+	return decompress.NewSalvageReader(fi, st.Size()), nil
+}
+
+// reportSalvage prints the damage found in a salvaged file.
+func reportSalvage(file string, sr *decompress.SalvageReader) {
+	st := sr.Stats()
+	fmt.Fprintf(logOut, "%q: %d damaged regions, %d compressed bytes skipped, %d incomplete lines (%d bytes) lost.\n",
+		file, st.Damaged, st.SkippedBytes, st.LostLines, st.LostBytes)
+}
+
+// fileImport contains the state of a single file being imported.
+type fileImport struct {
+	file      string
+	parser    gonx.StringParser
+	container *containerLog     // nil if lines are not written by a container runtime.
+	meta      map[string]string // Fields added to each line.
+	store     traffic.RequestStore
+	acks      *ackTracker     // nil if the store does not acknowledge requests.
+	cp        *fileCheckpoint // nil if checkpoints are not saved.
+	p         *progress
+	pipe      *pipeline
+	offset    int64 // Offset after the last line read.
+	lines     int64 // Number of lines read.
+	maxLine   int   // Longer lines are rejected, if above zero.
+
+	rejected rejections // Rejected lines by kind of error.
+	noAbort  bool       // Line errors are logged and rejected with the abort policy.
+}
+
+// newFileImport returns an import of a file to the store.
+// resume must be called before lines are imported.
+func newFileImport(file string, store traffic.RequestStore) *fileImport {
+	f := &fileImport{
+		file:      file,
+		parser:    newLineParser(),
+		container: newContainerLog(),
+		store:     store,
+		p:         newProgress(file),
+
+		rejected: make(rejections),
+	}
+	if *containerMeta {
+		f.meta = containerPathMeta(file)
+	}
+	return f
+}
+
+// newStreamImport returns an import of a stream of lines that cannot
+// be resumed, like the messages received by a listener.
+// Lines can be imported immediately.
+func newStreamImport(name string, store traffic.RequestStore) *fileImport {
+	f := newFileImport(name, store)
+	if _, ok := store.(traffic.AckStore); ok {
+		f.acks = &ackTracker{}
+	}
+	f.pipe = newPipeline(*workers, *queueDepth, 1, f.parse, f.handle)
+	return f
+}
+
+// logErrors makes a stream import log the lines that cannot be parsed,
+// also with the abort policy, and the requests the store does not accept,
+// instead of stopping. Errors returned by the store still stop the import.
+func (f *fileImport) logErrors() {
+	f.noAbort = true
+	if f.acks != nil {
+		f.acks.report = func(sf traffic.StoreFailure) {
+			log.Printf("%s: line %d was not stored: %s", f.file, sf.Seq, sf.Reason)
+		}
+	}
+}
+
+// newLineParser returns a parser for the input format.
+func newLineParser() gonx.StringParser {
+	if *errorLog != "" {
+		return errorLogs[*errorLog]()
+	}
+	if *inputName != "" {
+		return inputs[*inputName]()
+	}
+	if jsonFields != nil {
+		return newJSONParser(jsonFields)
+	}
+	p, err := newParser(*format, formatEscape)
+	if err != nil {
+		// The format is checked before anything is imported.
+		panic(err)
+	}
+	return p
+}
+
+// resume will find the checkpoint of the open file and return the
+// offset where the import should continue. fi is nil for remote objects.
+// If a file has previously been imported, resume will wait for
+// the previous lines to be stored.
+func (f *fileImport) resume(fi *os.File) (int64, error) {
+	if f.pipe != nil {
+		err := f.pipe.wait()
+		if err != nil {
+			return 0, err
+		}
+	}
+	var cp checkpoint
+	var err error
+	f.cp, cp, err = newFileCheckpoint(f.file, fi, f.store)
 	if err != nil {
+		return 0, err
+	}
+	f.offset, f.lines = cp.Offset, cp.Lines
+	if as, ok := f.store.(traffic.AckStore); ok {
+		if f.acks == nil {
+			f.acks = &ackTracker{}
+		} else {
+			err := as.Flush()
+			if err != nil {
+				return 0, err
+			}
+		}
+		f.acks.reset(f.offset, f.lines)
+	}
+	if f.offset > 0 {
+		fmt.Fprintf(logOut, "Resuming %q after line %d.\n", f.file, f.lines)
+	}
+	f.parser = newLineParser()
+	f.container = newContainerLog()
+	f.pipe = newPipeline(*workers, *queueDepth, f.lines+1, f.parse, f.handle)
+	return f.offset, nil
+}
+
+// commit will wait for the lines sent to be stored, and save the
+// checkpoint of the open file. It is used before another file is resumed.
+func (f *fileImport) commit() error {
+	err := f.pipe.wait()
+	if err != nil || f.acks == nil {
 		return err
 	}
-	defer gr.Close()
+	err = f.store.(traffic.AckStore).Flush()
+	if err == nil {
+		err = f.acks.Err()
+	}
+	if err != nil {
+		return err
+	}
+	return f.cp.save(f.acks.committed())
+}
+
+// replay returns true if the lines before the offset of a resumed import
+// must be read, because the format of the file is declared by directive
+// lines in the file, or a line may be continued after the offset.
+func (f *fileImport) replay() bool {
+	_, ok := f.parser.(directiveParser)
+	return ok || f.container != nil
+}
 
-	// Track metrics for this file
-	n := 0
-	start := time.Now()
+// skipLines will read the lines before offset without importing them.
+// Directive lines are applied, so the following lines are parsed
+// with the format declared before them, and split container
+// lines are joined with the lines after offset.
+func (f *fileImport) skipLines(r *bufio.Reader, offset int64) error {
+	var n int64
+	for n < offset {
+		line, err := r.ReadString('\n')
+		n += int64(len(line))
+		s := strings.TrimRight(line, "\r\n")
+		if f.container != nil {
+			s, _, _ = f.container.unwrap(s)
+		}
+		if dp, ok := f.parser.(directiveParser); ok && isDirective(s) {
+			if p, err := dp.Directive(s); err == nil {
+				f.parser = p
+			}
+		}
+		if err == io.EOF && n == offset {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if n != offset {
+		return fmt.Errorf("offset is not at the end of a line")
+	}
+	return nil
+}
 
-	// Use gonx to split log files
-	reader := gonx.NewReader(gr, *format)
+// importLines will import all lines from the reader.
+func (f *fileImport) importLines(r *bufio.Reader) error {
 	for {
-		rec, err := reader.Read()
-		if err == io.EOF {
-			break
-		} else if err != nil {
+		line, long, err := readLine(r, f.maxLine)
+		if err != nil && err != io.EOF {
 			return err
 		}
+		if long > 0 {
+			err := f.rejectLong(long)
+			if err != nil {
+				return err
+			}
+		} else if len(line) > 0 {
+			err := f.importLine(line)
+			if err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// readLine reads a line, including the line feed.
+// If max is above zero and the line is longer, the line is
+// skipped, and its length is returned instead.
+func readLine(r *bufio.Reader, max int) (line string, long int64, err error) {
+	if max <= 0 {
+		line, err = r.ReadString('\n')
+		return line, 0, err
+	}
+	var buf []byte
+	for {
+		b, err := r.ReadSlice('\n')
+		if long == 0 && len(buf)+len(b) <= max {
+			buf = append(buf, b...)
+		} else {
+			long += int64(len(buf) + len(b))
+			buf = buf[:0]
+		}
+		if err != bufio.ErrBufferFull {
+			return string(buf), long, err
+		}
+	}
+}
+
+// rejectLong will send a line that is too long
+// to the pipeline as an error.
+func (f *fileImport) rejectLong(n int64) error {
+	f.offset += n
+	f.lines++
+	err := &lineError{Kind: "length", Err: fmt.Errorf("line exceeds %d bytes", f.maxLine)}
+	return f.pipe.send(&job{seq: f.lines, offset: f.offset, err: err})
+}
 
-		// Parse the entry
-		req, err := parseEntry(rec)
+// importLine will send a single line, including
+// the line feed, to the pipeline.
+func (f *fileImport) importLine(line string) error {
+	f.offset += int64(len(line))
+	f.lines++
+	j := &job{seq: f.lines, offset: f.offset, line: strings.TrimRight(line, "\r\n"), parser: f.parser}
+	if f.container != nil {
+		inner, complete, err := f.container.unwrap(j.line)
+		switch {
+		case err != nil:
+			j.err = &lineError{Kind: "container", Err: err}
+			return f.pipe.send(j)
+		case !complete:
+			// The line is sent with the line completing it.
+			j.partial = true
+			return f.pipe.send(j)
+		}
+		j.line = inner
+	}
+	if dp, ok := f.parser.(directiveParser); ok && isDirective(j.line) {
+		// The directive applies to the following lines.
+		p, err := dp.Directive(j.line)
 		if err != nil {
-			return err
+			j.err = &lineError{Kind: "directive", Err: err}
+		} else {
+			f.parser, j.directive = p, true
 		}
-		// We have an entry. Generate a hash for it, and enrich it.
-		req.GenerateHash()
-		req.Enrich()
+	}
+	return f.pipe.send(j)
+}
 
-		// Send it to the store
-		err = store.Store(*req)
+// parse will parse a single log line and enrich it.
+// It is called concurrently by the pipeline workers.
+func (f *fileImport) parse(j *job) {
+	if j.directive || j.partial || j.err != nil {
+		return
+	}
+	rec, err := j.parser.ParseString(j.line)
+	if err != nil {
+		j.err = &lineError{Kind: errKindFormat, Err: err}
+		return
+	}
+	for k, v := range f.meta {
+		rec.SetField(k, v)
+	}
+	if *errorLog != "" {
+		e, err := parseErrorEntry(rec)
 		if err != nil {
-			return err
+			j.err = err
+			return
 		}
+		e.GenerateHash()
+		j.errEntry = e
+		return
+	}
 
-		// Report metrics
-		n++
-		if n%1000 == 0 {
-			elapsed := time.Since(start)
-			fmt.Fprintf(logOut, "Processed %d, %0.2f entries/sec.\n", n, float64(n)/elapsed.Seconds())
+	// Parse the entry
+	req, err := parseEntry(rec)
+	if err != nil {
+		j.err = err
+		return
+	}
+	// We have an entry. Generate a hash for it, and enrich it.
+	req.GenerateHash()
+	req.Enrich()
+	j.req = req
+}
+
+// handle will send a parsed line to the store, and save a checkpoint
+// if needed. Lines that cannot be parsed are handled according to the
+// -on-error policy.
+// It is called by the pipeline in the order lines were read.
+func (f *fileImport) handle(j *job) error {
+	if j.err != nil {
+		return f.reject(j)
+	}
+	if j.directive || j.partial {
+		f.acks.skipped(j.seq, j.offset)
+		return nil
+	}
+	f.p.add()
+
+	// Send it to the store
+	if f.acks == nil {
+		if j.errEntry != nil {
+			return f.store.(traffic.ErrorStore).StoreError(*j.errEntry, j.seq, nil)
 		}
+		return f.store.Store(*j.req)
+	}
+	f.acks.sent(j.seq, j.offset)
+	var err error
+	if j.errEntry != nil {
+		err = f.store.(traffic.ErrorStore).StoreError(*j.errEntry, j.seq, f.acks)
+	} else {
+		err = f.store.(traffic.AckStore).StoreAck(*j.req, j.seq, f.acks)
+	}
+	if err != nil {
+		return err
 	}
-	// Print overall metrics
-	elapsed := time.Since(start)
-	fmt.Fprintf(logOut, "Processing %q took %s, processing %d entries.\n", file, elapsed, n)
-	fmt.Fprintf(logOut, "%0.2f entries/sec.", float64(n)/elapsed.Seconds())
+	err = f.acks.Err()
+	if err != nil {
+		return err
+	}
+	return f.cp.update(f.acks.committed())
+}
+
+// reject will handle a line that could not be parsed.
+// With the abort policy, lines that do not match the
+// format are skipped, and an error is returned for other errors,
+// unless noAbort is set.
+func (f *fileImport) reject(j *job) error {
+	kind := errKind(j.err)
+	if *onError == policyAbort && kind != errKindFormat {
+		if !f.noAbort {
+			return &abortError{Seq: j.seq, Err: j.err}
+		}
+		log.Printf("%s: line %d rejected: %v", f.file, j.seq, j.err)
+	}
+	f.rejected[kind]++
+	if rejected != nil {
+		err := rejected.Write(f.file, j.seq, j.line, j.err)
+		if err != nil {
+			return err
+		}
+	}
+	f.acks.skipped(j.seq, j.offset)
 	return nil
 }
 
+// finish will wait for the pipeline to handle all lines and
+// the store to acknowledge the imported lines,
+// save a checkpoint and print the metrics of the import.
+// An error is returned if any request could not be stored.
+func (f *fileImport) finish() error {
+	var err error
+	if f.pipe != nil {
+		err = f.pipe.wait()
+	}
+	f.p.done()
+	if n := f.rejected.total(); n > 0 {
+		fmt.Fprintf(logOut, "%q: %d lines rejected: %s.\n", f.file, n, f.rejected)
+	}
+	if f.acks == nil {
+		return err
+	}
+	if ferr := f.store.(traffic.AckStore).Flush(); err == nil {
+		err = ferr
+	}
+	if err == nil {
+		err = f.acks.Err()
+	}
+	stored, failed := f.acks.counts()
+	fmt.Fprintf(logOut, "%q: %d requests stored, %d failed.\n", f.file, stored, failed)
+
+	// Save the checkpoint of the stored lines, even if there are errors.
+	if cerr := f.cp.save(f.acks.committed()); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// progress tracks and reports import metrics for a single file.
+type progress struct {
+	file  string
+	n     int
+	start time.Time
+}
+
+// newProgress returns a progress tracker for a file,
+// with the clock started.
+func newProgress(file string) *progress {
+	return &progress{file: file, start: time.Now()}
+}
+
+// add will count an imported entry and report metrics for every 1000 entries.
+func (p *progress) add() {
+	p.n++
+	if p.n%1000 == 0 {
+		elapsed := time.Since(p.start)
+		fmt.Fprintf(logOut, "%q: processed %d, %0.2f entries/sec.\n", p.file, p.n, float64(p.n)/elapsed.Seconds())
+	}
+}
+
+// done will print the overall metrics.
+func (p *progress) done() {
+	elapsed := time.Since(p.start)
+	fmt.Fprintf(logOut, "Processing %q took %s, processing %d entries.\n", p.file, elapsed, p.n)
+	fmt.Fprintf(logOut, "%0.2f entries/sec.\n", float64(p.n)/elapsed.Seconds())
+}
+
+// epochFields are fields with the time since the epoch, and the unit of the value.
+var epochFields = map[string]time.Duration{
+	"msec":      time.Second, // As nginx, seconds with millisecond resolution.
+	"time_msec": time.Millisecond,
+	"time_usec": time.Microsecond,
+}
+
+// parseEpoch parses a time since the epoch in the given unit,
+// for example "1286536308.779" seconds. The fraction is parsed exactly,
+// as float64 cannot hold nanoseconds since the epoch.
+func parseEpoch(s string, unit time.Duration) (time.Time, error) {
+	sec, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		sec, frac = s[:i], s[i+1:]
+	}
+	n, err := strconv.ParseInt(sec, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	ns := n * int64(unit)
+	if frac != "" {
+		if len(frac) > 9 {
+			frac = frac[:9]
+		}
+		f, err := strconv.ParseUint(frac, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		for i := len(frac); i > 0; i-- {
+			unit /= 10
+		}
+		ns += int64(f) * int64(unit)
+	}
+	return time.Unix(0, ns).UTC(), nil
+}
+
+// durationFields are fields with the time taken to serve
+// the request, and the unit of the value.
+var durationFields = map[string]time.Duration{
+	"request_time":    time.Second,
+	"request_time_ms": time.Millisecond,
+	"request_time_us": time.Microsecond,
+	"request_time_ns": time.Nanosecond,
+}
+
 // parseEntry parses a single entry and returns a typed Request.
 // Individual fields that are missing are ignored, but if a field is found
 // it must be parseable, otherwise an error will be returned.
@@ -215,34 +886,156 @@ func parseEntry(rec *gonx.Entry) (*traffic.Request, error) {
 
 	// Individual fields that are missing are ignored.
 	req.Remote, _ = rec.Field("remote_addr")
+	if a := optField(rec, "downstream_remote_address"); req.Remote == "" && a != "" {
+		req.Remote = hostOnly(a)
+	}
 	req.URI, _ = rec.Field("uri")
 	req.Method, _ = rec.Field("method")
 	req.Protocol, _ = rec.Field("protocol")
+	req.RemoteUser = optField(rec, "remote_user")
+	req.Referer = optField(rec, "http_referer")
+	req.UserAgent = optField(rec, "http_user_agent")
+	req.VirtualHost = optField(rec, "server_name", "host")
+	req.UpstreamAddr = optField(rec, "upstream_addr")
+	req.ForwardedFor = optField(rec, "http_x_forwarded_for")
+	req.RequestID = optField(rec, "request_id", "http_x_request_id", "env_unique_id")
+	req.TLSProtocol = optField(rec, "ssl_protocol")
+	req.TLSCipher = optField(rec, "ssl_cipher")
+	req.EdgeLocation = optField(rec, "edge_location")
+	req.Frontend = optField(rec, "frontend")
+	req.Backend = optField(rec, "backend")
+	req.Server = optField(rec, "backend_server")
+	req.CacheResult = optField(rec, "cache_result")
+	req.Hierarchy = optField(rec, "hierarchy")
+	req.DestHost = optField(rec, "dest_host")
+	if f := optField(rec, "response_flags"); f != "" {
+		req.ResponseFlags = strings.Split(f, ",")
+	}
+
+	// The request line, for example "GET / HTTP/1.1".
+	// Lines that are not valid are marked as malformed.
+	f, err := rec.Field("request")
+	if err == nil {
+		req.Method, req.URI, req.Protocol, req.Malformed = parseRequestLine(f)
+	}
 
-	f, err := rec.Field("time_local")
+	f, err = rec.Field("time_local")
 	if err == nil {
 		t, err := time.Parse(*timeFormat, f)
 		if err != nil {
-			return nil, err
+			return nil, &lineError{Kind: "time_local", Err: err}
+		}
+		req.ServerTime = t
+	}
+	f, err = rec.Field("time_iso8601")
+	if err == nil {
+		t, err := time.Parse(time.RFC3339, f)
+		if err != nil {
+			return nil, &lineError{Kind: "time_iso8601", Err: err}
 		}
 		req.ServerTime = t
 	}
 
+	// Time since the epoch.
+	for name, unit := range epochFields {
+		f, err = rec.Field(name)
+		if err == nil {
+			t, err := parseEpoch(f, unit)
+			if err != nil {
+				return nil, &lineError{Kind: name, Err: err}
+			}
+			req.ServerTime = t
+		}
+	}
+
 	f, err = rec.Field("status")
 	if err == nil {
 		req.StatusCode, err = strconv.Atoi(f)
 		if err != nil {
-			return nil, err
+			return nil, &lineError{Kind: "status", Err: err}
+		}
+	}
+	// The status returned by the upstream server. "-" if there was no response.
+	f, err = rec.Field("upstream_status")
+	if err == nil && f != "-" && f != "" {
+		req.UpstreamStatus, err = strconv.Atoi(f)
+		if err != nil {
+			return nil, &lineError{Kind: "upstream_status", Err: err}
 		}
 	}
 
 	// Size can be "-" on bodyless responses
-	f, err = rec.Field("size")
-	if err == nil && f != "-" {
-		req.Payload, err = strconv.Atoi(f)
+	for _, name := range []string{"size", "body_bytes_sent", "bytes_sent"} {
+		f, err = rec.Field(name)
+		if err == nil && f != "-" {
+			req.Payload, err = strconv.Atoi(f)
+			if err != nil {
+				return nil, &lineError{Kind: name, Err: err}
+			}
+			break
+		}
+	}
+
+	req.HAProxy, err = parseHAProxy(rec)
+	if err != nil {
+		return nil, err
+	}
+	req.Container = parseContainer(rec)
+	req.SyslogHost = optField(rec, "syslog_host")
+	req.SyslogApp = optField(rec, "syslog_app")
+
+	// Time taken to serve the request. "-" if unknown.
+	for name, unit := range durationFields {
+		f, err = rec.Field(name)
+		if err == nil && f != "-" {
+			v, err := strconv.ParseFloat(f, 64)
+			if err != nil {
+				return nil, &lineError{Kind: name, Err: err}
+			}
+			req.RequestTime = v * unit.Seconds()
+		}
+	}
+
+	// Time spent receiving the response from upstream servers.
+	// With several upstream servers the times are separated by commas or colons.
+	f, err = rec.Field("upstream_response_time")
+	if err == nil {
+		for _, v := range strings.FieldsFunc(f, isListSep) {
+			if v == "-" {
+				continue
+			}
+			t, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, &lineError{Kind: "upstream_response_time", Err: err}
+			}
+			req.UpstreamTime += t
+		}
+	}
+	// Envoy logs the upstream service time in milliseconds.
+	f, err = rec.Field("upstream_service_time")
+	if err == nil && f != "-" && f != "" {
+		t, err := strconv.ParseFloat(f, 64)
 		if err != nil {
-			return nil, err
+			return nil, &lineError{Kind: "upstream_service_time", Err: err}
 		}
+		req.UpstreamTime = t / 1000
 	}
 	return &req, nil
 }
+
+// optField returns the value of the first of the named fields with a value.
+// Missing fields and fields with the value "-" are returned as "".
+func optField(rec *gonx.Entry, names ...string) string {
+	for _, name := range names {
+		f, err := rec.Field(name)
+		if err == nil && f != "-" && f != "" {
+			return f
+		}
+	}
+	return ""
+}
+
+// isListSep returns true for separators in nginx upstream variables.
+func isListSep(r rune) bool {
+	return r == ',' || r == ':' || r == ' '
+}
@@ -2,11 +2,14 @@ package main
 
 import (
 	"bytes"
+	"compress/gzip"
 	"encoding/json"
 	"flag"
+	"io"
 	"io/ioutil"
 	"os"
 	"reflect"
+	"sync"
 	"testing"
 
 	"github.com/klauspost/InterviewAssignment/traffic"
@@ -94,3 +97,203 @@ func indexMaps(t *testing.T, in []map[string]interface{}) map[string]interface{}
 	}
 	return dst
 }
+
+// memStore is a RequestStore that keeps requests in memory.
+type memStore struct {
+	mu   sync.Mutex
+	reqs []traffic.Request
+	errs []traffic.ErrorEntry
+}
+
+func (m *memStore) Store(r traffic.Request) error {
+	m.mu.Lock()
+	m.reqs = append(m.reqs, r)
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *memStore) RemoveAll() error {
+	m.mu.Lock()
+	m.reqs = nil
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *memStore) StoreAck(r traffic.Request, seq int64, acker traffic.Acker) error {
+	m.Store(r)
+	acker.Ack(traffic.Ack{Stored: []int64{seq}})
+	return nil
+}
+
+func (m *memStore) StoreError(e traffic.ErrorEntry, seq int64, acker traffic.Acker) error {
+	m.mu.Lock()
+	m.errs = append(m.errs, e)
+	m.mu.Unlock()
+	if acker != nil {
+		acker.Ack(traffic.Ack{Stored: []int64{seq}})
+	}
+	return nil
+}
+
+func (m *memStore) Flush() error {
+	return nil
+}
+
+func (m *memStore) Close() error {
+	return nil
+}
+
+// URIs returns the URIs of the stored requests in the order they were stored.
+func (m *memStore) URIs() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	uris := make([]string, len(m.reqs))
+	for i, r := range m.reqs {
+		uris[i] = r.URI
+	}
+	return uris
+}
+
+// Tests that uncompressed files are imported.
+func TestImportPlain(t *testing.T) {
+	logOut = ioutil.Discard
+	f, err := os.Open("testdata/sample-log.txt.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmp, err := ioutil.TempFile("", "sample-log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, gr)
+	tmp.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plain, gzipped := &memStore{}, &memStore{}
+	err = importFile(tmp.Name(), plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = importFile("testdata/sample-log.txt.gz", gzipped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(plain.reqs, gzipped.reqs) {
+		t.Fatal("plain import did not match gzipped import")
+	}
+}
+
+// Tests that a gzip file with a truncated second member can be salvaged.
+func TestImportSalvage(t *testing.T) {
+	logOut = ioutil.Discard
+	b, err := ioutil.ReadFile("testdata/sample-log.txt.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmp, err := ioutil.TempFile("", "sample-log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(append(b, b[:len(b)-20]...))
+	tmp.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = importFile(tmp.Name(), &memStore{})
+	if err == nil {
+		t.Fatal("expected error from truncated file")
+	}
+
+	*salvage = true
+	defer func() { *salvage = false }()
+	store := &memStore{}
+	err = importFile(tmp.Name(), store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(store.reqs) != 15 {
+		t.Fatalf("expected 15 requests from the first member, got %d", len(store.reqs))
+	}
+}
+
+// Tests that files are imported concurrently, and that an error
+// in one file is reported without stopping the others with -e.
+func TestImportFilesParallel(t *testing.T) {
+	logOut = ioutil.Discard
+	defer func(n int, e bool) {
+		*filesParallel, *continueError = n, e
+		exitCode = 0
+	}(*filesParallel, *continueError)
+	*filesParallel, *continueError = 3, true
+
+	// Silence the error report.
+	stderr := os.Stderr
+	os.Stderr, _ = os.Open(os.DevNull)
+	defer func() { os.Stderr = stderr }()
+
+	store := &memStore{}
+	sample := "testdata/sample-log.txt.gz"
+	importFiles([]string{sample, "testdata/does-not-exist.gz", sample, sample}, store)
+	if exitCode != 2 {
+		t.Fatalf("expected exit code 2, got %d", exitCode)
+	}
+	if len(store.reqs) != 3*15 {
+		t.Fatalf("expected %d requests, got %d", 3*15, len(store.reqs))
+	}
+}
+
+// Tests that the combined-log and upstream fields are parsed.
+func TestParseEntryFields(t *testing.T) {
+	p := mustParser(t, `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent" "$http_x_forwarded_for" $host $request_time "$upstream_response_time" "$upstream_addr" $request_id`, escapeDefault)
+	rec, err := p.ParseString(`10.0.0.1 - bob [01/Jul/1995:00:00:01 -0400] "GET /a HTTP/1.1" 200 12 "http://example.com/" "curl/7.47.0" "1.2.3.4, 10.0.0.2" www.example.com 0.250 "0.125, 0.5 : 0.25" "10.1.0.1:80, 10.1.0.2:80" 7f1c2a`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := parseEntry(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := traffic.Request{
+		ServerTime:   req.ServerTime,
+		Remote:       "10.0.0.1",
+		Method:       "GET",
+		URI:          "/a",
+		Protocol:     "HTTP/1.1",
+		StatusCode:   200,
+		Payload:      12,
+		RemoteUser:   "bob",
+		Referer:      "http://example.com/",
+		UserAgent:    "curl/7.47.0",
+		VirtualHost:  "www.example.com",
+		RequestTime:  0.25,
+		UpstreamTime: 0.875,
+		UpstreamAddr: "10.1.0.1:80, 10.1.0.2:80",
+		ForwardedFor: "1.2.3.4, 10.0.0.2",
+		RequestID:    "7f1c2a",
+	}
+	if !reflect.DeepEqual(*req, want) {
+		t.Fatalf("got %+v\nwant %+v", *req, want)
+	}
+
+	rec, err = p.ParseString(`10.0.0.1 - - [01/Jul/1995:00:00:01 -0400] "GET /a HTTP/1.1" 200 12 "-" "-" "-" www.example.com 0.001 "-" "-" -`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err = parseEntry(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.RemoteUser != "" || req.Referer != "" || req.UpstreamTime != 0 || req.UpstreamAddr != "" || req.RequestID != "" {
+		t.Fatalf("expected empty fields, got %+v", *req)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package main
+
+import "os"
+
+// fileInode returns 0, since inodes are not available on this platform.
+func fileInode(fi os.FileInfo) uint64 {
+	return 0
+}
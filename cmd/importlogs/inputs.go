@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/satyrius/gonx"
+)
+
+// inputs are parsers for logs that cannot be described
+// by a log format, selected with -input.
+var inputs = map[string]func() gonx.StringParser{
+	"w3c":        newW3CParser,
+	"alb":        newALBParser,
+	"elb":        newELBParser,
+	"cloudfront": newCloudFrontParser,
+	"haproxy":    newHAProxyParser,
+	"squid":      newSquidParser,
+}
+
+// inputNames returns the names of all inputs, sorted.
+func inputNames() []string {
+	names := make([]string, 0, len(inputs))
+	for name := range inputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyInput will select the parser for the named input.
+// The log format flags cannot be used with an input.
+func applyInput(name string) error {
+	set := flagsSet()
+	if set["format"] || set["preset"] || set["nginx-conf"] || set["apache-format"] || set["json"] || set["json-map"] {
+		return fmt.Errorf("-format, -preset, -nginx-conf, -apache-format and JSON input cannot be used with -input")
+	}
+	if _, ok := inputs[name]; !ok {
+		return fmt.Errorf("unknown input %q. Available inputs: %s", name, strings.Join(inputNames(), ", "))
+	}
+	return nil
+}
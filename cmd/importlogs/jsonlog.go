@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/satyrius/gonx"
+)
+
+// jsonMappings are the built-in mappings of JSON keys to field names.
+// Nested keys are separated by dots. Several keys can be given,
+// separated by '|', and the first key found is used.
+var jsonMappings = map[string]map[string]string{
+	// nginx log_format with escape=json, where keys are named
+	// as the variables, for example {"remote_addr":"$remote_addr",...}.
+	// All keys are used as field names, so no mapping is needed.
+	"nginx": {},
+	// Caddy v2 access logs.
+	"caddy": {
+		"remote_addr":          "request.remote_ip|request.client_ip|request.remote_addr",
+		"remote_user":          "user_id",
+		"method":               "request.method",
+		"uri":                  "request.uri",
+		"protocol":             "request.proto",
+		"server_name":          "request.host",
+		"http_referer":         "request.headers.Referer",
+		"http_user_agent":      "request.headers.User-Agent",
+		"http_x_forwarded_for": "request.headers.X-Forwarded-For",
+		"request_id":           "request.headers.X-Request-Id",
+		"status":               "status",
+		"size":                 "size",
+		"request_time":         "duration",
+		"msec":                 "ts",
+	},
+	// Traefik access logs with format=json.
+	"traefik": {
+		"remote_addr":          "ClientHost",
+		"remote_user":          "ClientUsername",
+		"method":               "RequestMethod",
+		"uri":                  "RequestPath",
+		"protocol":             "RequestProtocol",
+		"server_name":          "RequestHost",
+		"http_referer":         "request_Referer",
+		"http_user_agent":      "request_User-Agent",
+		"http_x_forwarded_for": "request_X-Forwarded-For",
+		"request_id":           "request_X-Request-Id",
+		"upstream_addr":        "ServiceAddr",
+		"status":               "DownstreamStatus",
+		"size":                 "DownstreamContentSize",
+		"request_time_ns":      "Duration",
+		"time_iso8601":         "StartUTC",
+	},
+}
+
+// jsonMapping returns the mapping of fields to JSON keys for the
+// named mapping, with the fields in extra added.
+// extra is a comma separated list of field=key pairs.
+func jsonMapping(name, extra string) (map[string]string, error) {
+	m := make(map[string]string)
+	if name != "" {
+		base, ok := jsonMappings[name]
+		if !ok {
+			names := make([]string, 0, len(jsonMappings))
+			for n := range jsonMappings {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("unknown JSON mapping %q. Available mappings: %s", name, strings.Join(names, ", "))
+		}
+		for k, v := range base {
+			m[k] = v
+		}
+	}
+	for _, kv := range strings.Split(extra, ",") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" {
+			continue
+		}
+		i := strings.IndexByte(kv, '=')
+		if i <= 0 || i == len(kv)-1 {
+			return nil, fmt.Errorf("invalid JSON mapping %q, expected field=key", kv)
+		}
+		m[kv[:i]] = kv[i+1:]
+	}
+	return m, nil
+}
+
+// applyJSON will read input as JSON lines with the given mapping.
+// The log format flags cannot be used with JSON input.
+func applyJSON(name, extra string) error {
+	set := flagsSet()
+	if set["format"] || set["preset"] || set["nginx-conf"] || set["apache-format"] {
+		return fmt.Errorf("-format, -preset, -nginx-conf and -apache-format cannot be used with JSON input")
+	}
+	m, err := jsonMapping(name, extra)
+	if err != nil {
+		return err
+	}
+	jsonFields = m
+	return nil
+}
+
+// jsonParser parses lines with a JSON object.
+// Mapped keys are returned as the field they are mapped to.
+// Top level keys that are not mapped are returned with their own
+// name, so objects with keys named as fields need no mapping.
+type jsonParser struct {
+	fields map[string]string
+}
+
+// newJSONParser returns a parser using the mapping of fields to JSON keys.
+func newJSONParser(fields map[string]string) *jsonParser {
+	return &jsonParser{fields: fields}
+}
+
+// ParseString parses a JSON object.
+func (p *jsonParser) ParseString(line string) (*gonx.Entry, error) {
+	var obj map[string]interface{}
+	dec := json.NewDecoder(strings.NewReader(line))
+	dec.UseNumber()
+	err := dec.Decode(&obj)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+	if obj == nil {
+		return nil, fmt.Errorf("line is not a JSON object")
+	}
+	entry := gonx.NewEmptyEntry()
+	mapped := make(map[string]bool)
+	for field, keys := range p.fields {
+		for _, key := range strings.Split(keys, "|") {
+			mapped[key] = true
+			if v, ok := jsonLookup(obj, key); ok {
+				if s, ok := jsonString(v); ok {
+					entry.SetField(field, s)
+					break
+				}
+			}
+		}
+	}
+	for key, v := range obj {
+		if mapped[key] {
+			continue
+		}
+		if _, err := entry.Field(key); err == nil {
+			continue
+		}
+		if s, ok := jsonString(v); ok {
+			entry.SetField(key, s)
+		}
+	}
+	return entry, nil
+}
+
+// jsonLookup returns the value of a key in an object.
+// Nested keys are separated by dots. Keys containing
+// dots are found if they exist in the object.
+func jsonLookup(obj map[string]interface{}, key string) (interface{}, bool) {
+	if v, ok := obj[key]; ok {
+		return v, true
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] != '.' {
+			continue
+		}
+		if o, ok := obj[key[:i]].(map[string]interface{}); ok {
+			if v, ok := jsonLookup(o, key[i+1:]); ok {
+				return v, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// jsonString returns a JSON value as a string.
+// Numbers are returned as written, and arrays are joined by ", ".
+// Objects and null values are not returned.
+func jsonString(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return fmt.Sprint(v), true
+	case []interface{}:
+		var b bytes.Buffer
+		for i, e := range v {
+			s, ok := jsonString(e)
+			if !ok {
+				return "", false
+			}
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(s)
+		}
+		return b.String(), true
+	}
+	return "", false
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestJSONParser(t *testing.T) {
+	tests := []struct {
+		name, extra, line string
+		want              map[string]string
+		time              time.Time
+	}{
+		{
+			name: "caddy",
+			line: `{"level":"info","ts":1646861401.5,"logger":"http.log.access","msg":"handled request","request":{"remote_ip":"127.0.0.1","remote_port":"41342","proto":"HTTP/2.0","method":"GET","host":"example.com","uri":"/a?b","headers":{"User-Agent":["curl/7.82.0"],"Accept":["*/*"]}},"user_id":"","duration":0.25,"size":10900,"status":404}`,
+			want: map[string]string{"remote": "127.0.0.1", "method": "GET", "uri": "/a?b", "protocol": "HTTP/2.0", "vhost": "example.com", "agent": "curl/7.82.0", "status": "404", "size": "10900", "duration": "0.25"},
+			time: time.Unix(1646861401, 5e8),
+		},
+		{
+			name: "traefik",
+			line: `{"ClientHost":"10.0.0.1","ClientUsername":"-","DownstreamContentSize":12,"DownstreamStatus":200,"Duration":1500000,"RequestHost":"example.com","RequestMethod":"POST","RequestPath":"/api","RequestProtocol":"HTTP/1.1","ServiceAddr":"10.1.0.1:80","StartUTC":"2020-06-15T13:51:22.5Z","request_User-Agent":"Go-http-client/1.1"}`,
+			want: map[string]string{"remote": "10.0.0.1", "method": "POST", "uri": "/api", "protocol": "HTTP/1.1", "vhost": "example.com", "agent": "Go-http-client/1.1", "status": "200", "size": "12", "duration": "0.0015"},
+			time: time.Date(2020, 6, 15, 13, 51, 22, 5e8, time.UTC),
+		},
+		{
+			name: "nginx",
+			line: `{"time_iso8601":"2020-06-15T13:51:22+00:00","remote_addr":"10.0.0.1","request":"GET / HTTP/1.1","status":"200","body_bytes_sent":"12","request_time":"0.250","http_user_agent":"say \"hi\""}`,
+			want: map[string]string{"remote": "10.0.0.1", "method": "GET", "uri": "/", "protocol": "HTTP/1.1", "agent": `say "hi"`, "status": "200", "size": "12", "duration": "0.25"},
+			time: time.Date(2020, 6, 15, 13, 51, 22, 0, time.UTC),
+		},
+		{
+			extra: "remote_addr=client.ip, uri=http.path, method=http.method, time_msec=timestamp, status=http.status",
+			line:  `{"client":{"ip":"10.0.0.2"},"http":{"method":"GET","path":"/b","status":"301"},"timestamp":1592229082500}`,
+			want:  map[string]string{"remote": "10.0.0.2", "method": "GET", "uri": "/b", "status": "301"},
+			time:  time.Unix(1592229082, 5e8),
+		},
+	}
+	for _, test := range tests {
+		m, err := jsonMapping(test.name, test.extra)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec, err := newJSONParser(m).ParseString(test.line)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		req, err := parseEntry(rec)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		got := map[string]string{"remote": req.Remote, "method": req.Method, "uri": req.URI, "protocol": req.Protocol, "vhost": req.VirtualHost, "agent": req.UserAgent}
+		if req.StatusCode != 0 {
+			got["status"] = strconv.Itoa(req.StatusCode)
+		}
+		if req.Payload != 0 {
+			got["size"] = strconv.Itoa(req.Payload)
+		}
+		if req.RequestTime != 0 {
+			got["duration"] = strconv.FormatFloat(req.RequestTime, 'f', -1, 64)
+		}
+		for k, v := range test.want {
+			if got[k] != v {
+				t.Errorf("%s: expected %s %q, got %q", test.name, k, v, got[k])
+			}
+		}
+		if !req.ServerTime.Equal(test.time) {
+			t.Errorf("%s: expected time %v, got %v", test.name, test.time, req.ServerTime)
+		}
+	}
+
+	_, err := newJSONParser(nil).ParseString(`{"remote_addr":`)
+	if err == nil {
+		t.Error("expected error on invalid JSON")
+	}
+	_, err = jsonMapping("nope", "")
+	if err == nil {
+		t.Error("expected error on unknown mapping")
+	}
+	_, err = jsonMapping("", "remote_addr")
+	if err == nil {
+		t.Error("expected error on invalid mapping")
+	}
+}
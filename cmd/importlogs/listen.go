@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/klauspost/InterviewAssignment/traffic"
+)
+
+// defaultListen are the addresses used if none are given to listen.
+var defaultListen = []string{"udp://:514", "tcp://:514"}
+
+// listener receives log lines on an address until it is closed.
+type listener interface {
+	// Failed returns a channel receiving an error if the
+	// listener stops receiving lines before it is closed.
+	Failed() <-chan error
+
+	// Close stops receiving lines, and waits for
+	// the received lines to be stored.
+	Close() error
+}
+
+// listenAddr starts receiving log lines on an address.
+// Syslog messages are received on udp:// and tcp:// addresses,
+// and batches of lines are pushed to http:// addresses.
+func listenAddr(addr string, store traffic.RequestStore) (listener, error) {
+	switch {
+	case strings.HasPrefix(addr, "udp://"), strings.HasPrefix(addr, "tcp://"):
+		l, err := listenSyslog(addr, store)
+		if err != nil {
+			return nil, err
+		}
+		return l, nil
+	case strings.HasPrefix(addr, "http://"):
+		l, err := listenPush(addr, store)
+		if err != nil {
+			return nil, err
+		}
+		return l, nil
+	}
+	return nil, fmt.Errorf("unknown listen address %q. Use udp://host:port, tcp://host:port or http://host:port/path", addr)
+}
+
+// listen will import the lines received on the addresses until
+// the process receives an interrupt or termination signal,
+// or a listener stops, so the process can be restarted.
+func listen(addrs []string, store traffic.RequestStore) {
+	if len(addrs) == 0 {
+		addrs = defaultListen
+	}
+	ls := make(map[string]listener)
+	for _, addr := range addrs {
+		l, err := listenAddr(addr, store)
+		if err != nil {
+			report(addr, err)
+			continue
+		}
+		log.Println("Listening on", addr)
+		ls[addr] = l
+	}
+
+	failed := make(chan error, len(ls))
+	for addr, l := range ls {
+		if c := l.Failed(); c != nil {
+			go func(addr string, c <-chan error) {
+				failed <- fmt.Errorf("%s: %v", addr, <-c)
+			}(addr, c)
+		}
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	var err error
+	select {
+	case <-sig:
+		log.Println("Stopping, waiting for pending lines.")
+	case err = <-failed:
+		log.Println("Stopping, a listener has stopped receiving lines.")
+	}
+	signal.Stop(sig)
+	for addr, l := range ls {
+		cerr := l.Close()
+		if cerr != nil {
+			report(addr, cerr)
+		}
+	}
+	if err != nil {
+		report("", err)
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/satyrius/gonx"
+)
+
+// Escaping of variables in nginx logs.
+// See http://nginx.org/en/docs/http/ngx_http_log_module.html#log_format
+const (
+	escapeDefault = "default" // '"', '\' and control characters are written as \xHH.
+	escapeJSON    = "json"    // Characters not allowed in JSON strings are escaped.
+	escapeNone    = "none"    // No escaping.
+)
+
+// nginxCombined is the predefined "combined" format of nginx.
+// It is used if the configuration does not define it.
+const nginxCombined = `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"`
+
+// applyNginxConf will set the -format flag from the log_format
+// with the given name in an nginx configuration file.
+// -format and -preset cannot be used with -nginx-conf.
+func applyNginxConf(path, name string) error {
+	set := flagsSet()
+	if set["format"] || set["preset"] {
+		return fmt.Errorf("-format and -preset cannot be used with -nginx-conf")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	*format, formatEscape, err = nginxLogFormat(f, name)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
+
+// nginxLogFormat reads an nginx configuration and returns
+// the log_format with the given name and its escaping.
+// Included files are not read.
+func nginxLogFormat(conf io.Reader, name string) (format, escape string, err error) {
+	b, err := ioutil.ReadAll(conf)
+	if err != nil {
+		return "", "", err
+	}
+	tokens, err := nginxTokens(b)
+	if err != nil {
+		return "", "", err
+	}
+	// Find the log_format directive.
+	var dir []string
+	for _, tok := range tokens {
+		switch {
+		case !tok.quoted && (tok.s == "{" || tok.s == "}"):
+			dir = dir[:0]
+		case !tok.quoted && tok.s == ";":
+			if len(dir) > 2 && dir[0] == "log_format" && dir[1] == name {
+				return nginxFormat(dir[2:])
+			}
+			dir = dir[:0]
+		default:
+			dir = append(dir, tok.s)
+		}
+	}
+	if name == "combined" {
+		return nginxCombined, escapeDefault, nil
+	}
+	return "", "", fmt.Errorf("log_format %q not found", name)
+}
+
+// nginxFormat returns the format and escaping from the
+// parameters of a log_format directive.
+// The strings of the format are joined, and variables
+// written as ${name} are converted to $name.
+func nginxFormat(params []string) (format, escape string, err error) {
+	escape = escapeDefault
+	if strings.HasPrefix(params[0], "escape=") {
+		escape = strings.TrimPrefix(params[0], "escape=")
+		params = params[1:]
+		switch escape {
+		case escapeDefault, escapeJSON, escapeNone:
+		default:
+			return "", "", fmt.Errorf("log_format: unknown escape=%s", escape)
+		}
+	}
+	format = strings.Join(params, "")
+	format = regexp.MustCompile(`\$\{([a-z0-9_]+)\}`).ReplaceAllString(format, "$$$1")
+	return format, escape, nil
+}
+
+// nginxToken is a word or a special character in an nginx configuration.
+type nginxToken struct {
+	s      string
+	quoted bool
+}
+
+// nginxTokens splits an nginx configuration into tokens.
+// Comments are removed, and quoted strings are unescaped.
+func nginxTokens(b []byte) ([]nginxToken, error) {
+	var tokens []nginxToken
+	for i := 0; i < len(b); {
+		c := b[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '#':
+			for i < len(b) && b[i] != '\n' {
+				i++
+			}
+		case c == ';' || c == '{' || c == '}':
+			tokens = append(tokens, nginxToken{s: string(c)})
+			i++
+		case c == '"' || c == '\'':
+			var s bytes.Buffer
+			i++
+			for ; i < len(b) && b[i] != c; i++ {
+				if b[i] == '\\' && i+1 < len(b) {
+					i++
+					switch b[i] {
+					case '"', '\'', '\\':
+					case 't':
+						s.WriteByte('\t')
+						continue
+					case 'r':
+						s.WriteByte('\r')
+						continue
+					case 'n':
+						s.WriteByte('\n')
+						continue
+					default:
+						s.WriteByte('\\')
+					}
+				}
+				s.WriteByte(b[i])
+			}
+			if i == len(b) {
+				return nil, fmt.Errorf("unterminated string in nginx configuration")
+			}
+			i++
+			tokens = append(tokens, nginxToken{s: s.String(), quoted: true})
+		default:
+			start := i
+			for i < len(b) && !strings.ContainsRune(" \t\r\n;{}", rune(b[i])) {
+				i++
+			}
+			tokens = append(tokens, nginxToken{s: string(b[start:i])})
+		}
+	}
+	return tokens, nil
+}
+
+// formatVar matches a variable and the delimiter after it in a quoted format.
+var formatVar = regexp.MustCompile(`\\\$([a-z0-9_]+)(\\?(.))`)
+
+// escapedParser parses lines of a log format.
+// If values are escaped, they are unescaped after the line has been parsed.
+type escapedParser struct {
+	re     *regexp.Regexp
+	escape string
+}
+
+// newParser returns a parser for the format with the given escaping
+// of values. If escape is empty, values are not unescaped.
+func newParser(format, escape string) (gonx.StringParser, error) {
+	// As gonx, but variable names may contain digits, like $time_iso8601,
+	// and quoted values may contain escaped quotes with JSON and Apache escaping.
+	re := formatVar.ReplaceAllStringFunc(regexp.QuoteMeta(format+" "), func(s string) string {
+		m := formatVar.FindStringSubmatch(s)
+		name, delim, c := m[1], m[2], m[3]
+		if (escape == escapeJSON || escape == escapeApache) && c == `"` {
+			return `(?P<` + name + `>(?:[^"\\]|\\.)*)` + delim
+		}
+		return `(?P<` + name + `>[^` + c + `]*)` + delim
+	})
+	compiled, err := regexp.Compile("^" + strings.Trim(re, " ") + "$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid log format %q: %v", format, err)
+	}
+	return &escapedParser{re: compiled, escape: escape}, nil
+}
+
+// ParseString parses a line and unescapes the values.
+func (p *escapedParser) ParseString(line string) (*gonx.Entry, error) {
+	fields := p.re.FindStringSubmatch(line)
+	if fields == nil {
+		return nil, fmt.Errorf("access log line '%v' does not match given format '%v'", line, p.re)
+	}
+	entry := gonx.NewEmptyEntry()
+	for i, name := range p.re.SubexpNames() {
+		if i == 0 {
+			continue
+		}
+		entry.SetField(name, p.unescape(fields[i]))
+	}
+	return entry, nil
+}
+
+// unescape a value. Values that cannot be unescaped are returned as is.
+func (p *escapedParser) unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	switch p.escape {
+	case escapeJSON:
+		if u, err := strconv.Unquote(`"` + s + `"`); err == nil {
+			return u
+		}
+	case escapeDefault, escapeApache:
+		var b bytes.Buffer
+		for i := 0; i < len(s); i++ {
+			if s[i] == '\\' && i+3 < len(s) && s[i+1] == 'x' {
+				if v, err := strconv.ParseUint(s[i+2:i+4], 16, 8); err == nil {
+					b.WriteByte(byte(v))
+					i += 3
+					continue
+				}
+			}
+			if s[i] == '\\' && i+1 < len(s) && p.escape == escapeApache {
+				switch s[i+1] {
+				case '"', '\\':
+					b.WriteByte(s[i+1])
+					i++
+					continue
+				case 'n':
+					b.WriteByte('\n')
+					i++
+					continue
+				case 't':
+					b.WriteByte('\t')
+					i++
+					continue
+				}
+			}
+			b.WriteByte(s[i])
+		}
+		return b.String()
+	}
+	return s
+}
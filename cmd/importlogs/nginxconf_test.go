@@ -0,0 +1,111 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/satyrius/gonx"
+)
+
+// mustParser returns a parser for a valid log format.
+func mustParser(t *testing.T, format, escape string) gonx.StringParser {
+	p, err := newParser(format, escape)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+const testNginxConf = `
+http {
+    # The default format.
+    log_format  main  '$remote_addr - $remote_user [$time_local] "$request" '
+                      '$status $body_bytes_sent "$http_referer" '
+                      '"$http_user_agent" "$http_x_forwarded_for"';
+
+    log_format json escape=json
+        '{"time":"$time_iso8601","remote_addr":"${remote_addr}",'
+        '"request":"$request","status":"$status","agent":"$http_user_agent"}';
+
+    server {
+        access_log /var/log/nginx/access.log main; # log_format ignored "comment";
+    }
+}
+`
+
+func TestNginxLogFormat(t *testing.T) {
+	format, escape, err := nginxLogFormat(strings.NewReader(testNginxConf), "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent" "$http_x_forwarded_for"`
+	if format != want || escape != escapeDefault {
+		t.Fatalf("unexpected format %q, escape %q", format, escape)
+	}
+
+	format, escape, err = nginxLogFormat(strings.NewReader(testNginxConf), "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = `{"time":"$time_iso8601","remote_addr":"$remote_addr","request":"$request","status":"$status","agent":"$http_user_agent"}`
+	if format != want || escape != escapeJSON {
+		t.Fatalf("unexpected format %q, escape %q", format, escape)
+	}
+
+	format, _, err = nginxLogFormat(strings.NewReader(testNginxConf), "combined")
+	if err != nil || format != nginxCombined {
+		t.Fatalf("expected predefined combined format, got %q, %v", format, err)
+	}
+	_, _, err = nginxLogFormat(strings.NewReader(testNginxConf), "missing")
+	if err == nil {
+		t.Fatal("expected error on missing format")
+	}
+}
+
+// Tests that escaped values are parsed and unescaped.
+func TestEscapedParser(t *testing.T) {
+	tests := []struct {
+		format, escape, line string
+		agent                string
+	}{
+		{
+			format: nginxCombined,
+			escape: escapeDefault,
+			line:   `10.0.0.1 - - [01/Jul/1995:00:00:01 -0400] "GET / HTTP/1.1" 200 12 "-" "say \x22hi\x22"`,
+			agent:  `say "hi"`,
+		},
+		{
+			format: `{"time":"$time_iso8601","request":"$request","status":"$status","agent":"$http_user_agent"}`,
+			escape: escapeJSON,
+			line:   `{"time":"1995-07-01T00:00:01-04:00","request":"GET / HTTP/1.1","status":"200","agent":"say \"hi\" \\o/"}`,
+			agent:  `say "hi" \o/`,
+		},
+	}
+	for _, test := range tests {
+		rec, err := mustParser(t, test.format, test.escape).ParseString(test.line)
+		if err != nil {
+			t.Errorf("%s: %v", test.escape, err)
+			continue
+		}
+		req, err := parseEntry(rec)
+		if err != nil {
+			t.Errorf("%s: %v", test.escape, err)
+			continue
+		}
+		if req.UserAgent != test.agent {
+			t.Errorf("%s: expected agent %q, got %q", test.escape, test.agent, req.UserAgent)
+		}
+		if req.Method != "GET" || req.URI != "/" || req.Protocol != "HTTP/1.1" || req.StatusCode != 200 {
+			t.Errorf("%s: unexpected request %+v", test.escape, req)
+		}
+		if req.ServerTime.Unix() != 804571201 {
+			t.Errorf("%s: unexpected time %v", test.escape, req.ServerTime)
+		}
+	}
+
+	// A format ending with a backslash cannot be compiled.
+	_, err := newParser(`$remote_addr\`, "")
+	if err == nil {
+		t.Error("expected error on invalid format")
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/klauspost/InterviewAssignment/traffic"
+	"github.com/satyrius/gonx"
+)
+
+// job is a single line passing through the pipeline.
+type job struct {
+	seq    int64  // Line number. Lines are numbered consecutively.
+	offset int64  // Offset after the line.
+	line   string // The line without line feed.
+
+	parser    gonx.StringParser // The parser for the line.
+	directive bool              // The line is a directive, which has been applied.
+	partial   bool              // The line is joined with the following lines.
+
+	// Set by the worker.
+	req      *traffic.Request
+	errEntry *traffic.ErrorEntry // Set instead of req for error logs.
+	err      error
+}
+
+// pipeline parses lines on several goroutines, and handles
+// the parsed lines in the order they were read.
+//
+// Lines are sent to a pool of workers, which each parse and enrich
+// a line at the time. A sequencer collects the parsed lines, restores
+// the input order and hands them to the handler.
+//
+// If the handler returns an error, the remaining lines are discarded.
+type pipeline struct {
+	in     chan *job
+	out    chan *job
+	slots  chan struct{} // A slot is taken for each line until it is handled.
+	done   chan struct{}
+	closed bool
+
+	mu  sync.Mutex
+	err error
+}
+
+// newPipeline starts a pipeline with the given number of workers,
+// where up to depth lines are being parsed or waiting to be handled.
+// next is the line number of the first line sent.
+func newPipeline(workers, depth int, next int64, parse func(*job), handle func(*job) error) *pipeline {
+	if workers < 1 {
+		workers = 1
+	}
+	if depth < 1 {
+		depth = 1
+	}
+	p := &pipeline{
+		in:    make(chan *job, depth),
+		out:   make(chan *job, depth),
+		slots: make(chan struct{}, depth),
+		done:  make(chan struct{}),
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for j := range p.in {
+				parse(j)
+				p.out <- j
+			}
+		}()
+	}
+	// Close the output when all workers are done.
+	go func() {
+		wg.Wait()
+		close(p.out)
+	}()
+	go p.sequence(next, handle)
+	return p
+}
+
+// sequence will hand the parsed lines to the handler in input order.
+func (p *pipeline) sequence(next int64, handle func(*job) error) {
+	defer close(p.done)
+	pending := make(map[int64]*job)
+	for j := range p.out {
+		pending[j.seq] = j
+		for {
+			j, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			if p.Err() == nil {
+				p.setErr(handle(j))
+			}
+			<-p.slots
+		}
+	}
+}
+
+// send a line to the pipeline. It blocks while depth lines
+// are being parsed or waiting to be handled.
+// If the handler has returned an error, it is returned.
+func (p *pipeline) send(j *job) error {
+	err := p.Err()
+	if err != nil {
+		return err
+	}
+	p.slots <- struct{}{}
+	p.in <- j
+	return nil
+}
+
+// wait will wait for all lines sent to be handled,
+// and return the first error returned by the handler.
+// No lines can be sent after wait has been called.
+func (p *pipeline) wait() error {
+	if !p.closed {
+		close(p.in)
+		p.closed = true
+	}
+	<-p.done
+	return p.Err()
+}
+
+// Err returns the first error returned by the handler.
+func (p *pipeline) Err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+func (p *pipeline) setErr(err error) {
+	if err == nil {
+		return
+	}
+	p.mu.Lock()
+	if p.err == nil {
+		p.err = err
+	}
+	p.mu.Unlock()
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/klauspost/InterviewAssignment/traffic"
+)
+
+// Tests that lines are handled in input order, and that
+// no lines are handled after the handler returns an error.
+func TestPipelineOrder(t *testing.T) {
+	var got []int64
+	parse := func(j *job) {
+		time.Sleep(time.Duration(rand.Intn(100)) * time.Microsecond)
+	}
+	handle := func(j *job) error {
+		got = append(got, j.seq)
+		if j.seq == 900 {
+			return errors.New("stop")
+		}
+		return nil
+	}
+	p := newPipeline(8, 10, 1, parse, handle)
+	for i := int64(1); i <= 1000; i++ {
+		if p.send(&job{seq: i}) != nil {
+			break
+		}
+	}
+	err := p.wait()
+	if err == nil || err.Error() != "stop" {
+		t.Fatalf("expected error from handler, got %v", err)
+	}
+	if len(got) != 900 {
+		t.Fatalf("expected 900 lines handled, got %d", len(got))
+	}
+	for i, seq := range got {
+		if seq != int64(i+1) {
+			t.Fatalf("line %d handled as number %d", seq, i+1)
+		}
+	}
+}
+
+// Tests that no more than depth lines are sent
+// while the first line is being parsed.
+func TestPipelineDepth(t *testing.T) {
+	release := make(chan struct{})
+	parse := func(j *job) {
+		if j.seq == 1 {
+			<-release
+		}
+	}
+	p := newPipeline(4, 10, 1, parse, func(*job) error { return nil })
+	var sent int64
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := int64(1); i <= 100; i++ {
+			p.send(&job{seq: i})
+			atomic.AddInt64(&sent, 1)
+		}
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if n := atomic.LoadInt64(&sent); n != 10 {
+		t.Errorf("expected 10 lines sent, got %d", n)
+	}
+	close(release)
+	<-done
+	err := p.wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// discardStore acknowledges and discards all requests.
+type discardStore struct{}
+
+func (discardStore) Store(traffic.Request) error { return nil }
+func (discardStore) StoreAck(r traffic.Request, seq int64, acker traffic.Acker) error {
+	acker.Ack(traffic.Ack{Stored: []int64{seq}})
+	return nil
+}
+func (discardStore) Flush() error     { return nil }
+func (discardStore) RemoveAll() error { return nil }
+func (discardStore) Close() error     { return nil }
+
+// benchmarkImport imports the sample log repeated 1000 times
+// with the given number of workers.
+func benchmarkImport(b *testing.B, n int) {
+	logOut = ioutil.Discard
+	f, err := os.Open("testdata/sample-log.txt.gz")
+	if err != nil {
+		b.Fatal(err)
+	}
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		b.Fatal(err)
+	}
+	sample, err := ioutil.ReadAll(gr)
+	f.Close()
+	if err != nil {
+		b.Fatal(err)
+	}
+	tmp, err := ioutil.TempFile("", "sample-log")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.Remove(tmp.Name())
+	for i := 0; i < 1000; i++ {
+		_, err := tmp.Write(sample)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	err = tmp.Close()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	defer func(n int) { *workers = n }(*workers)
+	*workers = n
+	b.SetBytes(int64(len(sample) * 1000))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := importFile(tmp.Name(), discardStore{})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkImportWorkers1(b *testing.B) { benchmarkImport(b, 1) }
+func BenchmarkImportWorkers2(b *testing.B) { benchmarkImport(b, 2) }
+func BenchmarkImportWorkers4(b *testing.B) { benchmarkImport(b, 4) }
+func BenchmarkImportWorkers8(b *testing.B) { benchmarkImport(b, 8) }
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// apacheTime is the time format used by Apache and nginx logs.
+const apacheTime = `02/Jan/2006:15:04:05 -0700`
+
+// preset is a named log format with its time format.
+type preset struct {
+	format     string
+	timeFormat string
+}
+
+// presets contains the built-in log formats.
+// Field names follow the nginx variable names.
+var presets = map[string]preset{
+	// The format of the NASA reference logs. This is the default.
+	"nasa": {
+		format:     `$remote_addr - - [$time_local] "$request" $status $size`,
+		timeFormat: apacheTime,
+	},
+	// Apache: LogFormat "%h %l %u %t \"%r\" %>s %b" common
+	"common": {
+		format:     `$remote_addr $remote_logname $remote_user [$time_local] "$request" $status $size`,
+		timeFormat: apacheTime,
+	},
+	// Apache: LogFormat "%h %l %u %t \"%r\" %>s %b \"%{Referer}i\" \"%{User-Agent}i\"" combined
+	"combined": {
+		format:     `$remote_addr $remote_logname $remote_user [$time_local] "$request" $status $size "$http_referer" "$http_user_agent"`,
+		timeFormat: apacheTime,
+	},
+	// Apache: LogFormat "%v:%p %h %l %u %t \"%r\" %>s %O \"%{Referer}i\" \"%{User-Agent}i\"" vhost_combined
+	"vhost_combined": {
+		format:     `$server_name:$server_port $remote_addr $remote_logname $remote_user [$time_local] "$request" $status $bytes_sent "$http_referer" "$http_user_agent"`,
+		timeFormat: apacheTime,
+	},
+	// The default "main" log_format of nginx.
+	"nginx": {
+		format:     `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent" "$http_x_forwarded_for"`,
+		timeFormat: apacheTime,
+	},
+}
+
+// presetNames returns the names of all presets, sorted.
+func presetNames() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyPreset will set the -format and -timeformat flags from a preset.
+// -format cannot be combined with a preset, but an explicit
+// -timeformat overrides the time format of the preset.
+func applyPreset(name string) error {
+	p, ok := presets[name]
+	if !ok {
+		return fmt.Errorf("unknown preset %q. Available presets: %s", name, strings.Join(presetNames(), ", "))
+	}
+	set := flagsSet()
+	if set["format"] {
+		return fmt.Errorf("-format cannot be used with -preset")
+	}
+	*format = p.format
+	if !set["timeformat"] {
+		*timeFormat = p.timeFormat
+	}
+	return nil
+}
+
+// flagsSet returns the names of the flags set on the command line.
+func flagsSet() map[string]bool {
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	return set
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/satyrius/gonx"
+)
+
+// Tests that a line in each preset format is parsed.
+func TestPresets(t *testing.T) {
+	defer func(f, tf string) {
+		*format, *timeFormat = f, tf
+	}(*format, *timeFormat)
+
+	tests := map[string]struct {
+		line                        string
+		user, referer, agent, vhost string
+		size                        int
+	}{
+		"nasa": {
+			line: `199.72.81.55 - - [01/Jul/1995:00:00:01 -0400] "GET /history/apollo/ HTTP/1.0" 200 6245`,
+			size: 6245,
+		},
+		"common": {
+			line: `127.0.0.1 - frank [01/Jul/1995:00:00:01 -0400] "GET /apache_pb.gif HTTP/1.0" 200 2326`,
+			user: "frank",
+			size: 2326,
+		},
+		"combined": {
+			line:    `127.0.0.1 - frank [01/Jul/1995:00:00:01 -0400] "GET /apache_pb.gif HTTP/1.0" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08 [en] (Win98; I ;Nav)"`,
+			user:    "frank",
+			referer: "http://www.example.com/start.html",
+			agent:   "Mozilla/4.08 [en] (Win98; I ;Nav)",
+			size:    2326,
+		},
+		"vhost_combined": {
+			line:  `www.example.com:80 127.0.0.1 - - [01/Jul/1995:00:00:01 -0400] "GET /apache_pb.gif HTTP/1.0" 200 2326 "-" "curl/7.47.0"`,
+			agent: "curl/7.47.0",
+			vhost: "www.example.com",
+			size:  2326,
+		},
+		"nginx": {
+			line:    `127.0.0.1 - - [01/Jul/1995:00:00:01 -0400] "GET /apache_pb.gif HTTP/1.1" 304 0 "http://www.example.com/" "curl/7.47.0" "-"`,
+			referer: "http://www.example.com/",
+			agent:   "curl/7.47.0",
+		},
+	}
+	for name, test := range tests {
+		p := presets[name]
+		*timeFormat = p.timeFormat
+		rec, err := gonx.NewParser(p.format).ParseString(test.line)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		req, err := parseEntry(rec)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if req.ServerTime.Unix() != 804571201 {
+			t.Errorf("%s: unexpected time %v", name, req.ServerTime)
+		}
+		if req.RemoteUser != test.user || req.Referer != test.referer || req.UserAgent != test.agent || req.VirtualHost != test.vhost {
+			t.Errorf("%s: unexpected fields %+v", name, req)
+		}
+		if req.Payload != test.size {
+			t.Errorf("%s: expected size %d, got %d", name, test.size, req.Payload)
+		}
+	}
+}
+
+func TestApplyPreset(t *testing.T) {
+	defer func(f, tf string) {
+		*format, *timeFormat = f, tf
+	}(*format, *timeFormat)
+
+	err := applyPreset("combined")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *format != presets["combined"].format {
+		t.Fatalf("format was not set: %s", *format)
+	}
+	err = applyPreset("nope")
+	if err == nil {
+		t.Fatal("expected error on unknown preset")
+	}
+}
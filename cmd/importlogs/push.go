@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/klauspost/InterviewAssignment/traffic"
+	"github.com/satyrius/gonx"
+)
+
+// Request headers selecting the format of a pushed batch.
+const (
+	headerLogFormat = "X-Log-Format" // A log format, like -format.
+	headerLogSource = "X-Log-Source" // The name of a preset or input.
+)
+
+// Limits of the push endpoint. They are variables,
+// so they can be changed by tests.
+var (
+	pushMaxBody       int64 = 64 << 20 // Bytes of a batch, also after decompression.
+	pushMaxLine             = 64 << 10 // Bytes of a line, including the line feed.
+	pushHeaderTimeout       = 10 * time.Second
+	pushReadTimeout         = 5 * time.Minute // Reading a batch, including the headers.
+	pushIdleTimeout         = 2 * time.Minute
+)
+
+// pushListener serves an HTTP endpoint receiving batches of
+// newline delimited log lines in the body of POST requests.
+//
+// Each batch is imported as a separate stream, and the response is
+// sent when its lines have been stored.
+type pushListener struct {
+	name  string // The address, for example "http://:8080/logs".
+	ln    net.Listener
+	path  string
+	store traffic.RequestStore
+
+	mu     sync.Mutex
+	wg     sync.WaitGroup // Batches being imported.
+	closed bool
+}
+
+// pushResult is the response to a pushed batch.
+type pushResult struct {
+	Accepted int64  `json:"accepted"`         // Lines stored.
+	Rejected int    `json:"rejected"`         // Lines that could not be parsed.
+	Failed   int64  `json:"failed,omitempty"` // Lines the store did not accept.
+	Error    string `json:"error,omitempty"`
+}
+
+// listenPush starts serving the endpoint on an address,
+// written as http://host:port/path. The path defaults to "/".
+func listenPush(addr string, store traffic.RequestStore) (*pushListener, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, err
+	}
+	l := &pushListener{name: addr, path: u.Path, store: store}
+	if l.path == "" {
+		l.path = "/"
+	}
+	l.ln, err = net.Listen("tcp", u.Host)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle(l.path, l)
+	srv := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: pushHeaderTimeout,
+		ReadTimeout:       pushReadTimeout,
+		IdleTimeout:       pushIdleTimeout,
+	}
+	go srv.Serve(l.ln)
+	return l, nil
+}
+
+// Addr returns the address the listener is receiving on.
+func (l *pushListener) Addr() net.Addr {
+	return l.ln.Addr()
+}
+
+// Failed returns nil, since each batch is imported separately,
+// and errors are returned in the response.
+func (l *pushListener) Failed() <-chan error {
+	return nil
+}
+
+// URL returns the URL of the endpoint.
+func (l *pushListener) URL() string {
+	return "http://" + l.Addr().String() + l.path
+}
+
+// ServeHTTP imports the lines of a batch.
+func (l *pushListener) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !l.begin() {
+		http.Error(w, "server is stopping", http.StatusServiceUnavailable)
+		return
+	}
+	defer l.wg.Done()
+
+	parser, err := pushParser(r.Header)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var body io.Reader = http.MaxBytesReader(w, r.Body, pushMaxBody)
+	switch enc := r.Header.Get("Content-Encoding"); enc {
+	case "", "identity":
+	case "gzip":
+		zr, err := gzip.NewReader(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer zr.Close()
+		body = http.MaxBytesReader(w, zr, pushMaxBody)
+	default:
+		http.Error(w, fmt.Sprintf("unsupported content encoding %q", enc), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	f := newStreamImport(r.RemoteAddr, l.store)
+	f.maxLine = pushMaxLine
+	if parser != nil {
+		f.parser = parser
+	}
+	status := http.StatusOK
+	err = f.importLines(bufio.NewReader(body))
+	if err != nil && f.pipe.Err() == nil {
+		// The batch could not be read, or is too large.
+		// The lines before the error are stored.
+		status = http.StatusBadRequest
+	}
+	if ferr := f.finish(); err == nil {
+		err = ferr
+	}
+
+	res := pushResult{Accepted: int64(f.p.n), Rejected: f.rejected.total()}
+	if f.acks != nil {
+		res.Accepted, res.Failed = f.acks.counts()
+	}
+	if err != nil {
+		res.Error = err.Error()
+		if _, ok := err.(*abortError); ok {
+			// -on-error=abort stopped the batch at a line that could not be parsed.
+			status = http.StatusBadRequest
+		}
+		if status == http.StatusOK {
+			status = http.StatusInternalServerError
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(res)
+}
+
+// begin registers a batch being imported.
+// If the listener is closed, false is returned.
+func (l *pushListener) begin() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return false
+	}
+	l.wg.Add(1)
+	return true
+}
+
+// pushParser returns the parser selected by the headers of a batch.
+// If no format is selected, nil is returned, and the lines are
+// parsed with the format of the command line.
+// Times are parsed with -timeformat.
+func pushParser(h http.Header) (gonx.StringParser, error) {
+	if name := h.Get(headerLogSource); name != "" {
+		if p, ok := presets[name]; ok {
+			return newParser(p.format, "")
+		}
+		if input, ok := inputs[name]; ok {
+			return input(), nil
+		}
+		return nil, fmt.Errorf("unknown log source %q", name)
+	}
+	if format := h.Get(headerLogFormat); format != "" {
+		return newParser(format, "")
+	}
+	return nil, nil
+}
+
+// Close stops accepting batches, and waits for
+// the batches being imported to be stored.
+func (l *pushListener) Close() error {
+	l.mu.Lock()
+	l.closed = true
+	l.mu.Unlock()
+	err := l.ln.Close()
+	l.wg.Wait()
+	return err
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/InterviewAssignment/traffic"
+)
+
+// testPush is a batch in the default format.
+const testPush = `199.72.81.55 - - [01/Jul/1995:00:00:01 -0400] "GET /history/apollo/ HTTP/1.0" 200 6245
+unicomp6.unicomp.net - - [01/Jul/1995:00:00:06 -0400] "GET /shuttle/countdown/ HTTP/1.0" 200 3985
+199.120.110.21 - - [01/Jul/1995:00:00:09 -0400] "GET /shuttle/missions/sts-73/mission-sts-73.html HTTP/1.0" 200 4085
+`
+
+// push sends a batch to the endpoint, and returns the status and result.
+func push(t *testing.T, url string, header map[string]string, body []byte) (int, pushResult) {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var res pushResult
+	if resp.Header.Get("Content-Type") == "application/json" {
+		err = json.NewDecoder(resp.Body).Decode(&res)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode, res
+}
+
+func TestPush(t *testing.T) {
+	logOut = ioutil.Discard
+	store := &memStore{}
+	srv := httptest.NewServer(&pushListener{store: store})
+	defer srv.Close()
+
+	// The command line format is used by default.
+	status, res := push(t, srv.URL, nil, []byte(testPush))
+	if status != http.StatusOK || res.Accepted != 3 || res.Rejected != 0 {
+		t.Fatalf("unexpected response %d %+v", status, res)
+	}
+
+	// A named source.
+	const combined = `10.0.0.1 - - [06/Oct/2016:00:17:09 +0000] "GET /combined HTTP/1.1" 200 612 "-" "curl/7.50"` + "\n" + "not a log line\n"
+	status, res = push(t, srv.URL, map[string]string{headerLogSource: "combined"}, []byte(combined))
+	if status != http.StatusOK || res.Accepted != 1 || res.Rejected != 1 {
+		t.Fatalf("unexpected response %d %+v", status, res)
+	}
+
+	// A log format, gzip encoded.
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte("10.0.0.2 [06/Oct/2016:00:17:10 +0000] \"GET /gzip HTTP/1.1\" 404\n10.0.0.3 [06/Oct/2016:00:17:11 +0000] \"GET /gzip2 HTTP/1.1\" 200"))
+	zw.Close()
+	header := map[string]string{headerLogFormat: `$remote_addr [$time_local] "$request" $status`, "Content-Encoding": "gzip"}
+	status, res = push(t, srv.URL, header, buf.Bytes())
+	if status != http.StatusOK || res.Accepted != 2 || res.Rejected != 0 {
+		t.Fatalf("unexpected response %d %+v", status, res)
+	}
+	uris := store.URIs()
+	if got := strings.Join(uris[len(uris)-3:], ","); got != "/combined,/gzip,/gzip2" {
+		t.Fatalf("unexpected URIs %s", got)
+	}
+
+	// A damaged gzip stream.
+	status, res = push(t, srv.URL, header, buf.Bytes()[:buf.Len()-10])
+	if status != http.StatusBadRequest || res.Error == "" {
+		t.Errorf("unexpected response %d %+v to damaged stream", status, res)
+	}
+
+	// A line that cannot be parsed stops the batch with -on-error=abort.
+	defer func(p string) { *onError = p }(*onError)
+	*onError = policyAbort
+	const bad = `10.0.0.4 - - [06/Oct/2016:00:17:12 +0000] "GET /before HTTP/1.1" 200 612` + "\n" +
+		`10.0.0.4 - - [06/Oct/2016:00:17:13 +0000] "GET /bad HTTP/1.1" 2x0 612` + "\n"
+	status, res = push(t, srv.URL, nil, []byte(bad))
+	if status != http.StatusBadRequest || res.Accepted != 1 || !strings.Contains(res.Error, "line 2: status") {
+		t.Errorf("unexpected response %d %+v to bad line", status, res)
+	}
+
+	for _, test := range []struct {
+		method string
+		header map[string]string
+		status int
+	}{
+		{"GET", nil, http.StatusMethodNotAllowed},
+		{"POST", map[string]string{headerLogSource: "nosuchsource"}, http.StatusBadRequest},
+		{"POST", map[string]string{headerLogFormat: `$remote_addr\`}, http.StatusBadRequest},
+		{"POST", map[string]string{"Content-Encoding": "br"}, http.StatusUnsupportedMediaType},
+		{"POST", map[string]string{"Content-Encoding": "gzip"}, http.StatusBadRequest},
+	} {
+		req, err := http.NewRequest(test.method, srv.URL, strings.NewReader("line\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range test.header {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.status {
+			t.Errorf("%s %v: got status %d, want %d", test.method, test.header, resp.StatusCode, test.status)
+		}
+	}
+}
+
+// Tests that batches and lines above the limits are rejected.
+func TestPushLimits(t *testing.T) {
+	logOut = ioutil.Discard
+	store := &memStore{}
+	srv := httptest.NewServer(&pushListener{store: store})
+	defer srv.Close()
+	defer func(n int64, l int) { pushMaxBody, pushMaxLine = n, l }(pushMaxBody, pushMaxLine)
+	pushMaxBody, pushMaxLine = 1<<10, 200
+	defer func(p string) { *onError = p }(*onError)
+	*onError = policySkip
+
+	// A line that is too long is rejected.
+	long := strings.Repeat("x", 3*pushMaxLine) + "\n"
+	status, res := push(t, srv.URL, nil, []byte(long+testPush))
+	if status != http.StatusOK || res.Accepted != 3 || res.Rejected != 1 {
+		t.Fatalf("unexpected response %d %+v to long line", status, res)
+	}
+	*onError = policyAbort
+	status, res = push(t, srv.URL, nil, []byte(testPush+long))
+	if status != http.StatusBadRequest || res.Accepted != 3 || !strings.Contains(res.Error, "line 4: length") {
+		t.Errorf("unexpected response %d %+v to long line", status, res)
+	}
+
+	// A batch that is too large is not read.
+	large := []byte(strings.Repeat(testPush, 1+int(pushMaxBody)/len(testPush)))
+	status, res = push(t, srv.URL, nil, large)
+	if status != http.StatusBadRequest || !strings.Contains(res.Error, "too large") {
+		t.Errorf("unexpected response %d %+v to large batch", status, res)
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(large)
+	zw.Close()
+	status, res = push(t, srv.URL, map[string]string{"Content-Encoding": "gzip"}, buf.Bytes())
+	if status != http.StatusBadRequest || !strings.Contains(res.Error, "too large") {
+		t.Errorf("unexpected response %d %+v to large gzip encoded batch", status, res)
+	}
+}
+
+// failStore is a store whose backend is unavailable.
+type failStore struct {
+	memStore
+}
+
+func (f *failStore) StoreAck(r traffic.Request, seq int64, acker traffic.Acker) error {
+	return errors.New("backend unavailable")
+}
+
+// Tests that a batch that cannot be stored is answered with 500.
+func TestPushStoreFailure(t *testing.T) {
+	logOut = ioutil.Discard
+	srv := httptest.NewServer(&pushListener{store: &failStore{}})
+	defer srv.Close()
+
+	status, res := push(t, srv.URL, nil, []byte(testPush))
+	if status != http.StatusInternalServerError || res.Accepted != 0 || res.Error != "backend unavailable" {
+		t.Errorf("unexpected response %d %+v", status, res)
+	}
+}
+
+// Tests that batches are pushed to http:// listen addresses.
+func TestListenPush(t *testing.T) {
+	logOut = ioutil.Discard
+	store := &memStore{}
+	l, err := listenAddr("http://127.0.0.1:0/logs", store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pl := l.(*pushListener)
+	status, res := push(t, pl.URL(), nil, []byte(testPush))
+	if status != http.StatusOK || res.Accepted != 3 {
+		t.Fatalf("unexpected response %d %+v", status, res)
+	}
+	status, _ = push(t, "http://"+pl.Addr().String()+"/other", nil, []byte(testPush))
+	if status != http.StatusNotFound {
+		t.Errorf("expected status %d outside the path, got %d", http.StatusNotFound, status)
+	}
+	err = l.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(store.reqs) != 3 {
+		t.Fatalf("expected 3 requests, got %d", len(store.reqs))
+	}
+
+	_, err = listenAddr("ftp://127.0.0.1:0", store)
+	if err == nil {
+		t.Error("expected error on unknown scheme")
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/klauspost/InterviewAssignment/decompress"
+	"github.com/klauspost/InterviewAssignment/traffic"
+)
+
+// resumeDelay is the delay before the first attempt to resume an
+// interrupted download. It is doubled for each following attempt.
+var resumeDelay = time.Second
+
+// remoteReadTimeout is the time to wait for data from a remote object.
+// If no data is received, the read fails and the download is resumed.
+var remoteReadTimeout = time.Minute
+
+// remoteClient sends the requests for remote objects.
+var remoteClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: time.Minute,
+	},
+}
+
+// doRemote sends a request for a remote object with remoteClient.
+// Reading the body fails if no data is received for remoteReadTimeout.
+func doRemote(req *http.Request) (*http.Response, error) {
+	resp, err := remoteClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = newTimeoutBody(resp.Body, remoteReadTimeout)
+	return resp, nil
+}
+
+// timeoutBody is a body that is closed if a read does not return
+// within the timeout, so a stalled connection fails the read.
+type timeoutBody struct {
+	body    io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+	expired int32 // Set to 1 when the body has been closed by the timer.
+}
+
+func newTimeoutBody(body io.ReadCloser, timeout time.Duration) *timeoutBody {
+	b := &timeoutBody{body: body, timeout: timeout}
+	b.timer = time.AfterFunc(timeout, func() {
+		atomic.StoreInt32(&b.expired, 1)
+		b.body.Close()
+	})
+	b.timer.Stop()
+	return b
+}
+
+// Read reads from the body. The timer only runs while reading,
+// so a slow reader does not make the body expire.
+func (b *timeoutBody) Read(p []byte) (int, error) {
+	if atomic.LoadInt32(&b.expired) == 0 {
+		b.timer.Reset(b.timeout)
+		n, err := b.body.Read(p)
+		if b.timer.Stop() {
+			return n, err
+		}
+	}
+	return 0, fmt.Errorf("no data received for %v", b.timeout)
+}
+
+// Close stops the timer and closes the body.
+func (b *timeoutBody) Close() error {
+	b.timer.Stop()
+	return b.body.Close()
+}
+
+// rangeReader reads the body of a remote object. If the connection
+// fails, the rest of the object is requested with a Range request,
+// up to -download-retries times in a row.
+//
+// The object must not change while it is read: the ETag of each
+// response must match the first response, and the object must
+// have the size of the first response.
+type rangeReader struct {
+	url     string
+	do      func(req *http.Request) (*http.Response, error)
+	body    io.ReadCloser
+	offset  int64  // Bytes read.
+	size    int64  // Size of the object, or -1 if unknown.
+	etag    string // ETag of the object, "" if unknown.
+	retries int    // Failed attempts since data was last read.
+}
+
+// openRange requests an object, and returns a reader of its body.
+// Requests are sent with do.
+func openRange(url string, do func(req *http.Request) (*http.Response, error)) (*rangeReader, error) {
+	r := &rangeReader{url: url, do: do}
+	resp, err := r.get(false)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, responseError(resp)
+	}
+	r.body, r.size, r.etag = resp.Body, resp.ContentLength, resp.Header.Get("ETag")
+	return r, nil
+}
+
+// get sends a request for the object. When resuming,
+// the rest of the object after the offset is requested,
+// also if nothing has been read.
+func (r *rangeReader) get(resume bool) (*http.Response, error) {
+	req, err := http.NewRequest("GET", r.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Transparent decompression would hide the size of the object.
+	req.Header.Set("Accept-Encoding", "identity")
+	if resume {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(r.offset, 10)+"-")
+		// Weak ETags never match, but are compared in checkResume.
+		if r.etag != "" && !strings.HasPrefix(r.etag, "W/") {
+			req.Header.Set("If-Match", r.etag)
+		}
+	}
+	return r.do(req)
+}
+
+// Read reads from the body, and resumes the download if it fails.
+func (r *rangeReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.body.Read(p)
+		r.offset += int64(n)
+		if n > 0 {
+			r.retries = 0
+		}
+		switch {
+		case r.size >= 0 && r.offset > r.size:
+			return n, fmt.Errorf("read %d bytes, expected %d", r.offset, r.size)
+		case err == io.EOF && r.size >= 0 && r.offset < r.size:
+			err = io.ErrUnexpectedEOF
+		}
+		if err == nil || err == io.EOF {
+			return n, err
+		}
+		if n > 0 {
+			// Return the data, and resume on the next read.
+			return n, nil
+		}
+		err = r.resume(err)
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// resume requests the rest of the object after a read error.
+// If the download cannot be resumed, an error is returned.
+func (r *rangeReader) resume(cause error) error {
+	r.body.Close()
+	r.body = eofReader{}
+	if r.size < 0 {
+		return fmt.Errorf("%v (cannot resume download of unknown size)", cause)
+	}
+	for r.retries < *downloadRetries {
+		time.Sleep(resumeDelay << uint(r.retries))
+		r.retries++
+		log.Printf("%s: %v. Resuming download at byte %d (attempt %d).", r.url, cause, r.offset, r.retries)
+		resp, err := r.get(true)
+		if err != nil {
+			cause = err
+			continue
+		}
+		err = r.checkResume(resp)
+		if err != nil {
+			resp.Body.Close()
+			if resp.StatusCode >= 500 {
+				cause = err
+				continue
+			}
+			return err
+		}
+		r.body = resp.Body
+		return nil
+	}
+	return fmt.Errorf("%v (gave up after %d attempts to resume)", cause, r.retries)
+}
+
+// checkResume checks that a response contains the
+// rest of the same object after the offset.
+func (r *rangeReader) checkResume(resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		return fmt.Errorf("cannot resume download: server does not support Range requests")
+	case http.StatusPreconditionFailed:
+		return fmt.Errorf("cannot resume download: object was changed")
+	default:
+		return fmt.Errorf("cannot resume download: %v", responseError(resp))
+	}
+	if etag := resp.Header.Get("ETag"); r.etag != "" && etag != r.etag {
+		return fmt.Errorf("cannot resume download: object was changed (ETag %s, expected %s)", etag, r.etag)
+	}
+	want := fmt.Sprintf("bytes %d-%d/%d", r.offset, r.size-1, r.size)
+	if cr := resp.Header.Get("Content-Range"); cr != want {
+		return fmt.Errorf("cannot resume download: unexpected Content-Range %q, expected %q", cr, want)
+	}
+	return nil
+}
+
+// Close closes the body.
+func (r *rangeReader) Close() error {
+	return r.body.Close()
+}
+
+// responseError returns an error describing an unexpected response.
+// If the body is an S3 error document, its code and message are included.
+func responseError(resp *http.Response) error {
+	var e struct {
+		Code    string
+		Message string
+	}
+	b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4<<10))
+	if xml.Unmarshal(b, &e) == nil && e.Code != "" {
+		return fmt.Errorf("unexpected response %s: %s: %s", resp.Status, e.Code, e.Message)
+	}
+	return fmt.Errorf("unexpected response %s", resp.Status)
+}
+
+// eofReader is an empty body.
+type eofReader struct{}
+
+func (eofReader) Read([]byte) (int, error) { return 0, io.EOF }
+func (eofReader) Close() error             { return nil }
+
+// isRemote returns true if the input is a remote object.
+func isRemote(file string) bool {
+	for _, scheme := range []string{"s3://", "http://", "https://"} {
+		if strings.HasPrefix(file, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// openRemote returns a reader of a remote object.
+// Interrupted downloads are resumed.
+func openRemote(file string) (io.ReadCloser, error) {
+	if strings.HasPrefix(file, "s3://") {
+		return openS3Object(file)
+	}
+	return openRange(file, doRemote)
+}
+
+// importRemote will import a remote object.
+// Compression is detected automatically.
+// Checkpoints are not used.
+func importRemote(file string, store traffic.RequestStore) error {
+	body, err := openRemote(file)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	f := newFileImport(file, store)
+	_, err = f.resume(nil)
+	if err != nil {
+		return err
+	}
+	r, _, err := decompress.NewReader(body)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	err = f.importLines(bufio.NewReader(r))
+	if ferr := f.finish(); err == nil {
+		err = ferr
+	}
+	return err
+}
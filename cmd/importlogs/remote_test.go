@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// rangeServer serves an object, and interrupts responses
+// by closing the connection in the middle of the body,
+// or by no longer sending data.
+type rangeServer struct {
+	mu       sync.Mutex
+	data     []byte
+	etag     string
+	breaks   int    // Number of responses to interrupt.
+	stall    bool   // Leave interrupted connections open.
+	headOnly bool   // Interrupt responses before the body.
+	noRanges bool   // Ignore Range requests.
+	chunked  bool   // Use chunked transfer encoding.
+	next     string // ETag of the object after the first response.
+	grow     bool   // Append to the object after the first response.
+	ranges   []string
+}
+
+func (s *rangeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	start, status := 0, http.StatusOK
+	if rng := r.Header.Get("Range"); rng != "" && !s.noRanges {
+		s.ranges = append(s.ranges, rng)
+		if m := r.Header.Get("If-Match"); m != "" && m != s.etag {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		start, _ = strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(rng, "bytes="), "-"))
+		status = http.StatusPartialContent
+	}
+	body := s.data[start:]
+	send, stall := len(body), false
+	if s.breaks > 0 {
+		s.breaks--
+		send /= 2
+		if s.headOnly {
+			send = 0
+		}
+		stall = s.stall
+	}
+
+	conn, buf, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		panic(err)
+	}
+	if stall {
+		// The connection is closed by the client.
+		defer func() { go io.Copy(ioutil.Discard, conn) }()
+	} else {
+		defer conn.Close()
+	}
+	fmt.Fprintf(buf, "HTTP/1.1 %d %s\r\nConnection: close\r\n", status, http.StatusText(status))
+	if s.etag != "" {
+		fmt.Fprintf(buf, "ETag: %s\r\n", s.etag)
+	}
+	if status == http.StatusPartialContent {
+		fmt.Fprintf(buf, "Content-Range: bytes %d-%d/%d\r\n", start, len(s.data)-1, len(s.data))
+	}
+	if s.chunked {
+		fmt.Fprintf(buf, "Transfer-Encoding: chunked\r\n\r\n%x\r\n%s\r\n", send, body[:send])
+		if send == len(body) {
+			fmt.Fprintf(buf, "0\r\n\r\n")
+		}
+	} else {
+		fmt.Fprintf(buf, "Content-Length: %d\r\n\r\n", len(body))
+		buf.Write(body[:send])
+	}
+	buf.Flush()
+
+	if s.next != "" {
+		s.etag = s.next
+	}
+	if s.grow {
+		s.data = append(s.data, "more\n"...)
+	}
+}
+
+// Tests that an interrupted gzipped log is resumed and imported.
+func TestImportURL(t *testing.T) {
+	logOut = ioutil.Discard
+	defer func(d time.Duration) { resumeDelay = d }(resumeDelay)
+	resumeDelay = 0
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(testPush))
+	zw.Close()
+	s := &rangeServer{data: gz.Bytes(), etag: `"v1"`, breaks: 2}
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	store := &memStore{}
+	err := importFile(srv.URL+"/access.log.gz", store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(store.URIs(), ","); got != "/history/apollo/,/shuttle/countdown/,/shuttle/missions/sts-73/mission-sts-73.html" {
+		t.Fatalf("unexpected URIs %s", got)
+	}
+	half := gz.Len() / 2
+	want := []string{"bytes=" + strconv.Itoa(half) + "-", "bytes=" + strconv.Itoa(half+(gz.Len()-half)/2) + "-"}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if strings.Join(s.ranges, ",") != strings.Join(want, ",") {
+		t.Errorf("got ranges %q, want %q", s.ranges, want)
+	}
+}
+
+func TestRangeReader(t *testing.T) {
+	defer func(d, r time.Duration) { resumeDelay, remoteReadTimeout = d, r }(resumeDelay, remoteReadTimeout)
+	resumeDelay, remoteReadTimeout = 0, 100*time.Millisecond
+	data := []byte(strings.Repeat("0123456789", 10))
+
+	for _, test := range []struct {
+		name string
+		s    *rangeServer
+		err  string // Part of the expected error, "" if the object is read.
+	}{
+		{"complete", &rangeServer{etag: `"v1"`}, ""},
+		{"resumed", &rangeServer{etag: `"v1"`, breaks: 3}, ""},
+		{"weak etag", &rangeServer{etag: `W/"v1"`, breaks: 1}, ""},
+		{"no etag", &rangeServer{breaks: 1}, ""},
+		{"interrupted before body", &rangeServer{etag: `"v1"`, breaks: 1, headOnly: true}, ""},
+		{"stalled", &rangeServer{etag: `"v1"`, breaks: 2, stall: true}, ""},
+		{"changed", &rangeServer{etag: `"v1"`, next: `"v2"`, breaks: 1}, "object was changed"},
+		{"changed weak etag", &rangeServer{etag: `W/"v1"`, next: `W/"v2"`, breaks: 1}, "object was changed (ETag"},
+		{"changed size", &rangeServer{etag: `"v1"`, grow: true, breaks: 1}, "unexpected Content-Range"},
+		{"no ranges", &rangeServer{etag: `"v1"`, noRanges: true, breaks: 1}, "does not support Range"},
+		{"unknown size", &rangeServer{etag: `"v1"`, chunked: true, breaks: 1}, "unknown size"},
+		{"gave up", &rangeServer{etag: `"v1"`, breaks: 100}, "gave up after 5 attempts"},
+	} {
+		test.s.data = append([]byte(nil), data...)
+		srv := httptest.NewServer(test.s)
+		r, err := openRange(srv.URL, doRemote)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		got, err := ioutil.ReadAll(r)
+		r.Close()
+		srv.Close()
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%s: %v", test.name, err)
+		case test.err == "" && !bytes.Equal(got, data):
+			t.Errorf("%s: got %q, want %q", test.name, got, data)
+		case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+			t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+		}
+	}
+
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	_, err := openRange(srv.URL, doRemote)
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
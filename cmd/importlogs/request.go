@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net"
+	"regexp"
+	"strings"
+)
+
+// httpProtocol matches the protocol of a request line.
+var httpProtocol = regexp.MustCompile(`^HTTP/[0-9]+(\.[0-9]+)?$`)
+
+// httpMethod matches a request method.
+var httpMethod = regexp.MustCompile(`^[A-Z][A-Z_-]*$`)
+
+// parseRequestLine splits a request line, for example "GET / HTTP/1.1",
+// into method, URI and protocol.
+//
+// A request line with only a method and a URI is an HTTP/0.9 request.
+// If the line is not a valid request line, malformed is true, and the
+// parts that can be identified are returned. If no method can be found,
+// the whole line is returned as the URI.
+func parseRequestLine(s string) (method, uri, protocol string, malformed bool) {
+	for i := 0; i < len(s); i++ {
+		if s[i] < ' ' || s[i] > '~' {
+			return "", s, "", true
+		}
+	}
+	p := strings.Fields(s)
+	if len(p) == 0 || !httpMethod.MatchString(p[0]) {
+		return "", s, "", true
+	}
+	method, p = p[0], p[1:]
+	switch {
+	case len(p) == 0:
+		return method, "", "", true
+	case len(p) == 1 && httpProtocol.MatchString(p[0]):
+		// No URI.
+		return method, "", p[0], true
+	case len(p) == 1:
+		return method, p[0], "HTTP/0.9", method != "GET"
+	}
+	last := p[len(p)-1]
+	if !httpProtocol.MatchString(last) {
+		// A URI with spaces, and no protocol.
+		return method, strings.Join(p, " "), "", true
+	}
+	// A URI with spaces is malformed.
+	return method, strings.Join(p[:len(p)-1], " "), last, len(p) > 2
+}
+
+// splitAbsoluteURI splits an absolute http or https URI into
+// the host and the URI without scheme and host.
+// Ports are removed from the host.
+// If the URI is not absolute, ok is false.
+func splitAbsoluteURI(s string) (host, uri string, ok bool) {
+	var rest string
+	switch {
+	case strings.HasPrefix(s, "http://"):
+		rest = s[len("http://"):]
+	case strings.HasPrefix(s, "https://"):
+		rest = s[len("https://"):]
+	default:
+		return "", s, false
+	}
+	i := strings.IndexAny(rest, "/?#")
+	if i < 0 {
+		i = len(rest)
+	}
+	host, uri = rest[:i], rest[i:]
+	if !strings.HasPrefix(uri, "/") {
+		uri = "/" + uri
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return host, uri, host != ""
+}
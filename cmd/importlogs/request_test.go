@@ -0,0 +1,48 @@
+package main
+
+import "testing"
+
+func TestParseRequestLine(t *testing.T) {
+	tests := []struct {
+		line                  string
+		method, uri, protocol string
+		malformed             bool
+	}{
+		{line: "GET /a HTTP/1.1", method: "GET", uri: "/a", protocol: "HTTP/1.1"},
+		{line: "POST /a?b=c HTTP/2", method: "POST", uri: "/a?b=c", protocol: "HTTP/2"},
+		{line: "GET /shuttle/countdown/", method: "GET", uri: "/shuttle/countdown/", protocol: "HTTP/0.9"},
+		{line: "GET /a b.html HTTP/1.0", method: "GET", uri: "/a b.html", protocol: "HTTP/1.0", malformed: true},
+		{line: "GET /a b.html", method: "GET", uri: "/a b.html", malformed: true},
+		{line: "HEAD /a", method: "HEAD", uri: "/a", protocol: "HTTP/0.9", malformed: true},
+		{line: "GET HTTP/1.0", method: "GET", protocol: "HTTP/1.0", malformed: true},
+		{line: "GET", method: "GET", malformed: true},
+		{line: "", malformed: true},
+		{line: "\x16\x03\x01\x00\xa5", uri: "\x16\x03\x01\x00\xa5", malformed: true},
+		{line: "get / HTTP/1.1", uri: "get / HTTP/1.1", malformed: true},
+	}
+	for _, test := range tests {
+		method, uri, protocol, malformed := parseRequestLine(test.line)
+		if method != test.method || uri != test.uri || protocol != test.protocol || malformed != test.malformed {
+			t.Errorf("%q: got %q %q %q %v", test.line, method, uri, protocol, malformed)
+		}
+	}
+}
+
+func TestSplitAbsoluteURI(t *testing.T) {
+	tests := []struct {
+		in, host, uri string
+		ok            bool
+	}{
+		{in: "/a", uri: "/a"},
+		{in: "http://example.com:80/a?b", host: "example.com", uri: "/a?b", ok: true},
+		{in: "https://example.com", host: "example.com", uri: "/", ok: true},
+		{in: "http://example.com?a", host: "example.com", uri: "/?a", ok: true},
+		{in: "http://[::1]:8080/", host: "::1", uri: "/", ok: true},
+	}
+	for _, test := range tests {
+		host, uri, ok := splitAbsoluteURI(test.in)
+		if host != test.host || uri != test.uri || ok != test.ok {
+			t.Errorf("%s: got %q %q %v", test.in, host, uri, ok)
+		}
+	}
+}
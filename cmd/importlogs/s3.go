@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// emptySHA256 is the SHA-256 hash of an empty payload.
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// s3Client sends requests to an S3 compatible object storage.
+// Buckets are addressed in the path of the endpoint, which is supported
+// by AWS, MinIO and most other implementations.
+type s3Client struct {
+	endpoint  string // For example https://s3.us-east-1.amazonaws.com
+	region    string
+	accessKey string // Requests are not signed if empty.
+	secretKey string
+	token     string // Session token of temporary credentials.
+}
+
+// newS3Client returns a client using -s3-endpoint and -s3-region,
+// with the credentials of the AWS environment variables.
+func newS3Client() *s3Client {
+	c := &s3Client{
+		endpoint:  strings.TrimSuffix(*s3Endpoint, "/"),
+		region:    *s3Region,
+		accessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		token:     os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	for _, env := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if c.region == "" {
+			c.region = os.Getenv(env)
+		}
+	}
+	if c.region == "" {
+		c.region = "us-east-1"
+	}
+	if c.endpoint == "" {
+		c.endpoint = "https://s3." + c.region + ".amazonaws.com"
+	}
+	return c
+}
+
+// parseS3URL splits an s3://bucket/key URL.
+func parseS3URL(s string) (bucket, key string, err error) {
+	if !strings.HasPrefix(s, "s3://") {
+		return "", "", fmt.Errorf("%q is not an s3:// URL", s)
+	}
+	bucket = strings.TrimPrefix(s, "s3://")
+	if i := strings.IndexByte(bucket, '/'); i >= 0 {
+		bucket, key = bucket[:i], bucket[i+1:]
+	}
+	if bucket == "" {
+		return "", "", fmt.Errorf("%q has no bucket", s)
+	}
+	return bucket, key, nil
+}
+
+// expandS3 replaces the s3://bucket/prefix arguments by
+// the objects with the prefix. Errors are reported for
+// each argument.
+func expandS3(args []string) []string {
+	var files []string
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "s3://") {
+			files = append(files, arg)
+			continue
+		}
+		objs, err := listS3(arg)
+		if err != nil {
+			report(arg, err)
+			continue
+		}
+		files = append(files, objs...)
+	}
+	return files
+}
+
+// listS3 returns the objects with the prefix of an s3://bucket/prefix URL,
+// sorted by key.
+func listS3(prefix string) ([]string, error) {
+	bucket, key, err := parseS3URL(prefix)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := newS3Client().list(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no objects found")
+	}
+	objs := make([]string, len(keys))
+	for i, k := range keys {
+		objs[i] = "s3://" + bucket + "/" + k
+	}
+	return objs, nil
+}
+
+// openS3Object returns a reader of an s3://bucket/key object.
+// Interrupted downloads are resumed.
+func openS3Object(obj string) (io.ReadCloser, error) {
+	bucket, key, err := parseS3URL(obj)
+	if err != nil {
+		return nil, err
+	}
+	c := newS3Client()
+	return openRange(c.objectURL(bucket, key), c.do)
+}
+
+// objectURL returns the URL of an object.
+func (c *s3Client) objectURL(bucket, key string) string {
+	return c.endpoint + "/" + s3Escape(bucket, false) + "/" + s3Escape(key, true)
+}
+
+// s3ListResult is a page of a ListObjectsV2 response.
+type s3ListResult struct {
+	Contents []struct {
+		Key  string
+		Size int64
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+// list returns the keys of the objects in the bucket with the prefix.
+// Keys of folders, ending with "/", are left out.
+func (c *s3Client) list(bucket, prefix string) ([]string, error) {
+	var keys []string
+	q := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+	for {
+		req, err := http.NewRequest("GET", c.endpoint+"/"+s3Escape(bucket, false)+"?"+canonicalQuery(q), nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			err = responseError(resp)
+			resp.Body.Close()
+			return nil, err
+		}
+		var res s3ListResult
+		err = xml.NewDecoder(resp.Body).Decode(&res)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("listing objects: %v", err)
+		}
+		for _, obj := range res.Contents {
+			if !strings.HasSuffix(obj.Key, "/") {
+				keys = append(keys, obj.Key)
+			}
+		}
+		if !res.IsTruncated || res.NextContinuationToken == "" {
+			return keys, nil
+		}
+		q.Set("continuation-token", res.NextContinuationToken)
+	}
+}
+
+// do signs and sends a request.
+func (c *s3Client) do(req *http.Request) (*http.Response, error) {
+	c.sign(req, time.Now())
+	return doRemote(req)
+}
+
+// sign signs a request without body with AWS Signature Version 4.
+// The host and all headers of the request are signed.
+// See http://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html
+func (c *s3Client) sign(req *http.Request, now time.Time) {
+	if c.accessKey == "" {
+		return
+	}
+	amzDate := now.UTC().Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptySHA256)
+	if c.token != "" {
+		req.Header.Set("X-Amz-Security-Token", c.token)
+	}
+	signed := []string{"host"}
+	for k := range req.Header {
+		signed = append(signed, strings.ToLower(k))
+	}
+	sort.Strings(signed)
+	scope := amzDate[:8] + "/" + c.region + "/s3/aws4_request"
+	sig := s3Signature(req, signed, c.secretKey, scope, amzDate)
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.accessKey, scope, strings.Join(signed, ";"), sig))
+}
+
+// s3Signature returns the signature of a request,
+// with the signed headers in sorted order.
+func s3Signature(req *http.Request, signed []string, secretKey, scope, amzDate string) string {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	path := req.URL.Path
+	if path == "" {
+		path = "/"
+	}
+	var cr bytes.Buffer
+	fmt.Fprintf(&cr, "%s\n%s\n%s\n", req.Method, s3Escape(path, true), canonicalQuery(req.URL.Query()))
+	for _, h := range signed {
+		v := host
+		if h != "host" {
+			v = strings.Join(strings.Fields(strings.Join(req.Header[http.CanonicalHeaderKey(h)], ",")), " ")
+		}
+		fmt.Fprintf(&cr, "%s:%s\n", h, v)
+	}
+	fmt.Fprintf(&cr, "\n%s\n%s", strings.Join(signed, ";"), req.Header.Get("X-Amz-Content-Sha256"))
+
+	hash := sha256.Sum256(cr.Bytes())
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+	key := []byte("AWS4" + secretKey)
+	for _, s := range strings.Split(scope, "/") {
+		key = hmacSHA256(key, s)
+	}
+	return hex.EncodeToString(hmacSHA256(key, toSign))
+}
+
+func hmacSHA256(key []byte, s string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
+
+// canonicalQuery returns the query sorted by name and value.
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var params []string
+	for _, k := range keys {
+		vs := append([]string(nil), q[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			params = append(params, s3Escape(k, false)+"="+s3Escape(v, false))
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// s3Escape percent-encodes all characters except the unreserved characters
+// of RFC 3986. If path is true, slashes are not encoded.
+func s3Escape(s string, path bool) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '.', c == '_', c == '~', c == '/' && path:
+			buf.WriteByte(c)
+		default:
+			fmt.Fprintf(&buf, "%%%02X", c)
+		}
+	}
+	return buf.String()
+}
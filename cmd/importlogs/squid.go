@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/satyrius/gonx"
+)
+
+// squidFields are the fields of the Squid native log format, in order.
+// The result code and the hierarchy code are split further by the parser.
+// See https://wiki.squid-cache.org/Features/LogFormat#Squid_native_access.log_format_in_detail
+var squidFields = []string{
+	"msec", "request_time_ms", "remote_addr", "result_code", "bytes_sent",
+	"method", "url", "remote_user", "hierarchy_code", "sent_http_content_type",
+}
+
+// squidParser parses Squid native access logs.
+type squidParser struct{}
+
+// newSquidParser returns a parser for the Squid native log format.
+func newSquidParser() gonx.StringParser {
+	return squidParser{}
+}
+
+// ParseString parses a Squid log line, for example:
+//
+//	1286536308.779    180 192.168.0.224 TCP_MISS/200 411 GET http://www.google.com/ - HIER_DIRECT/74.125.229.51 text/html
+func (squidParser) ParseString(line string) (*gonx.Entry, error) {
+	// Fields are padded with spaces, so the elapsed time lines up.
+	values := strings.Fields(line)
+	if len(values) < len(squidFields) {
+		return nil, fmt.Errorf("line has %d fields, expected %d", len(values), len(squidFields))
+	}
+	entry := gonx.NewEmptyEntry()
+	for i, name := range squidFields {
+		entry.SetField(name, values[i])
+	}
+
+	// The result code is the cache result and the status, for example TCP_MISS/200.
+	code := values[3]
+	i := strings.IndexByte(code, '/')
+	if i < 0 {
+		return nil, &lineError{Kind: "result_code", Err: fmt.Errorf("no status in %q", code)}
+	}
+	entry.SetField("cache_result", code[:i])
+	entry.SetField("status", code[i+1:])
+
+	// The hierarchy code and the peer the request was forwarded to, for example HIER_DIRECT/74.125.229.51.
+	hier := strings.SplitN(values[8], "/", 2)
+	entry.SetField("hierarchy", hier[0])
+	if len(hier) == 2 && hier[1] != "-" {
+		entry.SetField("upstream_addr", hier[1])
+	}
+
+	// Forward proxies log the full URL. CONNECT requests log host:port.
+	url := values[6]
+	if host, uri, ok := splitAbsoluteURI(url); ok {
+		entry.SetField("dest_host", host)
+		entry.SetField("uri", uri)
+	} else {
+		if values[5] == "CONNECT" {
+			entry.SetField("dest_host", hostOnly(url))
+		}
+		entry.SetField("uri", url)
+	}
+	return entry, nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSquid(t *testing.T) {
+	req := parseInput(t, "squid", `1286536308.779    180 192.168.0.224 TCP_MISS/200 411 GET http://www.google.com/search?q=squid - HIER_DIRECT/74.125.229.51 text/html`)
+	if want := time.Date(2010, 10, 8, 11, 11, 48, 779e6, time.UTC); !req.ServerTime.Equal(want) {
+		t.Errorf("expected time %v, got %v", want, req.ServerTime)
+	}
+	if req.Remote != "192.168.0.224" || req.Method != "GET" || req.URI != "/search?q=squid" || req.StatusCode != 200 || req.Payload != 411 {
+		t.Errorf("unexpected request %+v", *req)
+	}
+	if req.CacheResult != "TCP_MISS" || req.Hierarchy != "HIER_DIRECT" || req.UpstreamAddr != "74.125.229.51" || req.DestHost != "www.google.com" {
+		t.Errorf("unexpected request %+v", *req)
+	}
+	if req.RequestTime != 0.18 || req.VirtualHost != "" || req.RemoteUser != "" {
+		t.Errorf("unexpected request %+v", *req)
+	}
+
+	// A cache hit with an authenticated user.
+	req = parseInput(t, "squid", `1286536309.100      2 192.168.0.224 TCP_MEM_HIT/200 5120 GET http://example.com:8080/logo.png alice HIER_NONE/- image/png`)
+	if req.CacheResult != "TCP_MEM_HIT" || req.Hierarchy != "HIER_NONE" || req.UpstreamAddr != "" || req.DestHost != "example.com" || req.RemoteUser != "alice" {
+		t.Errorf("unexpected request %+v", *req)
+	}
+
+	// CONNECT requests log the destination as host:port.
+	req = parseInput(t, "squid", `1286536310.000  60012 192.168.0.224 TCP_TUNNEL/200 8832 CONNECT mail.example.com:443 - HIER_DIRECT/10.0.0.5 -`)
+	if req.Method != "CONNECT" || req.URI != "mail.example.com:443" || req.DestHost != "mail.example.com" || req.CacheResult != "TCP_TUNNEL" {
+		t.Errorf("unexpected request %+v", *req)
+	}
+
+	for _, line := range []string{
+		`1286536308.779 180 192.168.0.224 TCP_MISS/200 411 GET`,
+		`1286536308.779 180 192.168.0.224 TCP_MISS 411 GET http://www.google.com/ - HIER_DIRECT/74.125.229.51 text/html`,
+	} {
+		_, err := inputs["squid"]().ParseString(line)
+		if err == nil {
+			t.Errorf("expected error on %q", line)
+		}
+	}
+}
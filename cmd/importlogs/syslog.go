@@ -0,0 +1,379 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/InterviewAssignment/traffic"
+	"github.com/satyrius/gonx"
+)
+
+// maxSyslogMessage is the maximum size of a received message.
+const maxSyslogMessage = 64 << 10
+
+// syslogListener receives syslog messages on a UDP or TCP address,
+// and imports the payload of each message.
+//
+// Messages are imported as the lines of a single stream. When the
+// queue of the stream is full, messages are not read until there is
+// room for them. Over TCP this slows down the senders, while
+// messages over UDP are dropped by the operating system.
+//
+// Messages that cannot be parsed or are rejected by the store are logged.
+// If the store returns an error, the listener stops receiving messages,
+// and the error is sent on failed. Stores do not recover from errors.
+type syslogListener struct {
+	name   string // The address, for example "udp://:514".
+	pc     net.PacketConn
+	ln     net.Listener
+	wg     sync.WaitGroup
+	failed chan error
+
+	mu  sync.Mutex // Serializes the messages sent to imp.
+	imp *fileImport
+
+	connMu sync.Mutex
+	conns  map[net.Conn]struct{} // Open TCP connections.
+	closed bool
+}
+
+// listenSyslog starts receiving syslog messages on an address,
+// written as udp://host:port or tcp://host:port.
+func listenSyslog(addr string, store traffic.RequestStore) (*syslogListener, error) {
+	l := &syslogListener{name: addr, conns: make(map[net.Conn]struct{}), failed: make(chan error, 1)}
+	var err error
+	switch {
+	case strings.HasPrefix(addr, "udp://"):
+		l.pc, err = net.ListenPacket("udp", strings.TrimPrefix(addr, "udp://"))
+	case strings.HasPrefix(addr, "tcp://"):
+		l.ln, err = net.Listen("tcp", strings.TrimPrefix(addr, "tcp://"))
+	default:
+		return nil, fmt.Errorf("unknown listen address %q. Use udp://host:port or tcp://host:port", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	l.imp = newStreamImport(addr, store)
+	l.imp.parser = &syslogParser{inner: l.imp.parser}
+	// A bad message must not stop the listener.
+	l.imp.logErrors()
+
+	l.wg.Add(1)
+	if l.pc != nil {
+		go l.serveUDP()
+	} else {
+		go l.serveTCP()
+	}
+	return l, nil
+}
+
+// Addr returns the address the listener is receiving on.
+func (l *syslogListener) Addr() net.Addr {
+	if l.pc != nil {
+		return l.pc.LocalAddr()
+	}
+	return l.ln.Addr()
+}
+
+// serveUDP reads a message from each datagram until the listener is closed.
+func (l *syslogListener) serveUDP() {
+	defer l.wg.Done()
+	buf := make([]byte, maxSyslogMessage)
+	for {
+		n, _, err := l.pc.ReadFrom(buf)
+		if err == nil {
+			err = l.importMessage(string(buf[:n]))
+		}
+		if err != nil {
+			if !l.isClosed() {
+				l.fail(err)
+			}
+			return
+		}
+	}
+}
+
+// serveTCP accepts connections until the listener is closed.
+func (l *syslogListener) serveTCP() {
+	defer l.wg.Done()
+	for {
+		c, err := l.ln.Accept()
+		if err != nil {
+			if !l.isClosed() {
+				l.fail(fmt.Errorf("accepting connections: %v", err))
+			}
+			return
+		}
+		l.connMu.Lock()
+		if l.closed {
+			l.connMu.Unlock()
+			c.Close()
+			return
+		}
+		l.conns[c] = struct{}{}
+		l.wg.Add(1)
+		l.connMu.Unlock()
+		go l.serveConn(c)
+	}
+}
+
+// serveConn reads the messages of a connection until it is closed.
+func (l *syslogListener) serveConn(c net.Conn) {
+	defer l.wg.Done()
+	defer func() {
+		l.connMu.Lock()
+		delete(l.conns, c)
+		l.connMu.Unlock()
+		c.Close()
+	}()
+	r := bufio.NewReader(c)
+	for {
+		msg, err := readSyslogFrame(r)
+		if len(msg) > 0 {
+			if ierr := l.importMessage(msg); ierr != nil {
+				l.fail(ierr)
+				return
+			}
+		}
+		if err != nil {
+			if err != io.EOF && !l.isClosed() {
+				log.Printf("%s: %s: %v", l.name, c.RemoteAddr(), err)
+			}
+			return
+		}
+	}
+}
+
+// importMessage sends a message to the import.
+// If the queue is full, it blocks until there is room.
+func (l *syslogListener) importMessage(msg string) error {
+	if strings.TrimSpace(msg) == "" {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.imp.importLine(msg)
+}
+
+// fail logs that messages are no longer received, and reports the error.
+func (l *syslogListener) fail(err error) {
+	log.Printf("%s: stopped receiving messages: %v", l.name, err)
+	select {
+	case l.failed <- err:
+	default:
+	}
+}
+
+// Failed returns a channel receiving an error if the listener stops.
+func (l *syslogListener) Failed() <-chan error {
+	return l.failed
+}
+
+func (l *syslogListener) isClosed() bool {
+	l.connMu.Lock()
+	defer l.connMu.Unlock()
+	return l.closed
+}
+
+// Close stops receiving messages, closes the open connections,
+// and waits for the received messages to be stored.
+func (l *syslogListener) Close() error {
+	l.connMu.Lock()
+	l.closed = true
+	for c := range l.conns {
+		c.Close()
+	}
+	l.connMu.Unlock()
+	if l.pc != nil {
+		l.pc.Close()
+	} else {
+		l.ln.Close()
+	}
+	l.wg.Wait()
+	return l.imp.finish()
+}
+
+// readSyslogFrame reads a message from a TCP stream.
+// Messages are either octet counted, where the message is preceded by its
+// length, or terminated by a line feed. See RFC 6587, section 3.4.
+func readSyslogFrame(r *bufio.Reader) (string, error) {
+	b, err := r.Peek(1)
+	if err != nil {
+		return "", err
+	}
+	if b[0] < '1' || b[0] > '9' {
+		// Non-transparent framing.
+		var line []byte
+		for {
+			s, err := r.ReadSlice('\n')
+			line = append(line, s...)
+			if err == bufio.ErrBufferFull && len(line) <= maxSyslogMessage {
+				continue
+			}
+			if err == bufio.ErrBufferFull || len(bytes.TrimRight(line, "\r\n")) > maxSyslogMessage {
+				return "", fmt.Errorf("message exceeds %d bytes", maxSyslogMessage)
+			}
+			if err == io.EOF && len(line) > 0 {
+				err = nil
+			}
+			return strings.TrimRight(string(line), "\r\n"), err
+		}
+	}
+	// Octet counting: MSG-LEN SP SYSLOG-MSG.
+	n, err := r.ReadString(' ')
+	if err != nil {
+		return "", fmt.Errorf("incomplete frame length")
+	}
+	size, err := strconv.Atoi(strings.TrimSuffix(n, " "))
+	if err != nil || size > maxSyslogMessage {
+		return "", fmt.Errorf("invalid frame length %q", strings.TrimSuffix(n, " "))
+	}
+	buf := make([]byte, size)
+	_, err = io.ReadFull(r, buf)
+	if err == io.ErrUnexpectedEOF {
+		err = fmt.Errorf("incomplete frame")
+	}
+	return string(buf), err
+}
+
+// syslogParser parses the payload of syslog messages with
+// the parser of the log format. The host and app of the
+// header are added to the entry.
+type syslogParser struct {
+	inner gonx.StringParser
+}
+
+// ParseString parses a syslog message.
+func (p *syslogParser) ParseString(line string) (*gonx.Entry, error) {
+	host, app, msg, err := parseSyslog(line)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := p.inner.ParseString(msg)
+	if err != nil {
+		return nil, err
+	}
+	if host != "" {
+		entry.SetField("syslog_host", host)
+	}
+	if app != "" {
+		entry.SetField("syslog_app", app)
+	}
+	return entry, nil
+}
+
+// parseSyslog splits a RFC 5424 or RFC 3164 message into the
+// host and app of the header, and the payload.
+func parseSyslog(line string) (host, app, msg string, err error) {
+	// The priority, for example <134>.
+	i := strings.IndexByte(line, '>')
+	if !strings.HasPrefix(line, "<") || i < 2 || i > 4 {
+		return "", "", "", fmt.Errorf("no syslog priority")
+	}
+	if _, err := strconv.Atoi(line[1:i]); err != nil {
+		return "", "", "", fmt.Errorf("invalid syslog priority %q", line[1:i])
+	}
+	rest := line[i+1:]
+	if strings.HasPrefix(rest, "1 ") {
+		return parseRFC5424(rest[2:])
+	}
+	host, app, msg = parseRFC3164(rest)
+	return host, app, msg, nil
+}
+
+// parseRFC5424 parses the header after the version:
+// TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG]
+func parseRFC5424(s string) (host, app, msg string, err error) {
+	f := strings.SplitN(s, " ", 6)
+	if len(f) < 6 {
+		return "", "", "", fmt.Errorf("incomplete RFC 5424 header")
+	}
+	host, app, sd := nilValue(f[1]), nilValue(f[2]), f[5]
+
+	// Skip the structured data, which is "-" or elements like [id name="value"].
+	i := 0
+	if strings.HasPrefix(sd, "-") {
+		i = 1
+	} else {
+		quoted := false
+		for i < len(sd) && sd[i] == '[' {
+			for i++; i < len(sd); i++ {
+				c := sd[i]
+				if c == '\\' && quoted {
+					i++
+				} else if c == '"' {
+					quoted = !quoted
+				} else if c == ']' && !quoted {
+					i++
+					break
+				}
+			}
+		}
+		if i == 0 {
+			return "", "", "", fmt.Errorf("invalid RFC 5424 structured data")
+		}
+	}
+	msg = strings.TrimPrefix(strings.TrimPrefix(sd[i:], " "), "\ufeff")
+	return host, app, msg, nil
+}
+
+// nilValue returns v, or "" if v is the nil value "-".
+func nilValue(v string) string {
+	if v == "-" {
+		return ""
+	}
+	return v
+}
+
+// parseRFC3164 parses the header after the priority:
+// TIMESTAMP [HOSTNAME] TAG: MSG
+// Senders differ, so missing parts are accepted.
+func parseRFC3164(s string) (host, app, msg string) {
+	// The timestamp, for example "Oct  6 00:17:09", or RFC 3339 as rsyslog can send.
+	if len(s) > len(time.Stamp) {
+		if _, err := time.Parse(time.Stamp, s[:len(time.Stamp)]); err == nil {
+			s = strings.TrimPrefix(s[len(time.Stamp):], " ")
+		} else if i := strings.IndexByte(s, ' '); i > 0 {
+			if _, err := time.Parse(time.RFC3339, s[:i]); err == nil {
+				s = s[i+1:]
+			}
+		}
+	}
+	// The hostname is left out by some senders, like HAProxy.
+	// The tag ends with ':' and may contain a pid, for example "haproxy[14389]:".
+	isTag := func(t string) bool {
+		return strings.HasSuffix(t, ":") || strings.Contains(t, "[")
+	}
+	tok, rest := splitToken(s)
+	if tok != "" && !isTag(tok) {
+		host = tok
+		s = rest
+		tok, rest = splitToken(s)
+	}
+	if tok == "" || !isTag(tok) {
+		return host, "", s
+	}
+	app = strings.TrimSuffix(tok, ":")
+	if i := strings.IndexByte(app, '['); i >= 0 {
+		app = app[:i]
+	}
+	return host, app, rest
+}
+
+// splitToken returns the text before the first space,
+// and the text after it.
+func splitToken(s string) (tok, rest string) {
+	i := strings.IndexByte(s, ' ')
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], s[i+1:]
+}
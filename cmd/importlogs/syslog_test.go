@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/InterviewAssignment/traffic"
+)
+
+func TestParseSyslog(t *testing.T) {
+	for _, test := range []struct {
+		line           string
+		host, app, msg string
+	}{
+		// nginx with "access_log syslog:server=...".
+		{`<190>Oct  6 00:17:09 web1 nginx: 10.0.0.1 - - [06/Oct/2016:00:17:09 +0000] "GET / HTTP/1.1" 200 612`,
+			"web1", "nginx", `10.0.0.1 - - [06/Oct/2016:00:17:09 +0000] "GET / HTTP/1.1" 200 612`},
+		// HAProxy leaves out the hostname.
+		{`<134>Feb  6 12:14:14 haproxy[14389]: 10.0.1.2:33317 [06/Feb/2009:12:14:14.655] http-in static/srv1`,
+			"", "haproxy", `10.0.1.2:33317 [06/Feb/2009:12:14:14.655] http-in static/srv1`},
+		// rsyslog with a RFC 3339 timestamp.
+		{`<13>2016-10-06T00:17:09.123+02:00 web2 app[1]: message`, "web2", "app", "message"},
+		// No tag.
+		{`<13>Oct 16 10:00:00 web3 10.0.0.1 - - x`, "web3", "", "10.0.0.1 - - x"},
+		// RFC 5424.
+		{`<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventSource="App]lication"][examplePriority@32473 class="high"] ` + "\ufeff" + `An application event`,
+			"mymachine.example.com", "evntslog", "An application event"},
+		{`<190>1 2016-10-06T00:17:09Z web1 nginx 1043 - - 10.0.0.1 - - [06/Oct/2016:00:17:09 +0000] "GET / HTTP/1.1" 200 612`,
+			"web1", "nginx", `10.0.0.1 - - [06/Oct/2016:00:17:09 +0000] "GET / HTTP/1.1" 200 612`},
+		{`<190>1 2016-10-06T00:17:09Z - - - - -`, "", "", ""},
+	} {
+		host, app, msg, err := parseSyslog(test.line)
+		if err != nil {
+			t.Errorf("%q: %v", test.line, err)
+			continue
+		}
+		if host != test.host || app != test.app || msg != test.msg {
+			t.Errorf("%q: got %q, %q, %q, want %q, %q, %q", test.line, host, app, msg, test.host, test.app, test.msg)
+		}
+	}
+	for _, line := range []string{
+		`Oct  6 00:17:09 web1 nginx: message`,
+		`<x>Oct  6 00:17:09 web1 nginx: message`,
+		`<165>1 2003-10-11T22:14:15.003Z host app`,
+		`<165>1 2003-10-11T22:14:15.003Z host app - ID47 x`,
+	} {
+		_, _, _, err := parseSyslog(line)
+		if err == nil {
+			t.Errorf("expected error on %q", line)
+		}
+	}
+}
+
+func TestReadSyslogFrame(t *testing.T) {
+	in := "<13>1 - - - - - - a\n" + "19 <13>1 - - - - - - b" + "<13>first\r\n" + "<13>last"
+	r := bufio.NewReader(strings.NewReader(in))
+	var got []string
+	for {
+		msg, err := readSyslogFrame(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, msg)
+	}
+	want := []string{"<13>1 - - - - - - a", "<13>1 - - - - - - b", "<13>first", "<13>last"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	_, err := readSyslogFrame(bufio.NewReader(strings.NewReader("30 <13>short")))
+	if err == nil {
+		t.Error("expected error on incomplete frame")
+	}
+
+	// Messages terminated by a line feed are limited like octet counted messages.
+	long := "<13>" + strings.Repeat("a", maxSyslogMessage-4)
+	msg, err := readSyslogFrame(bufio.NewReader(strings.NewReader(long + "\r\n")))
+	if err != nil || msg != long {
+		t.Errorf("got %d bytes, %v reading message of maximum size", len(msg), err)
+	}
+	_, err = readSyslogFrame(bufio.NewReader(strings.NewReader(long + "a\n")))
+	if err == nil {
+		t.Error("expected error on too long message")
+	}
+	_, err = readSyslogFrame(bufio.NewReader(strings.NewReader(long + strings.Repeat("a", maxSyslogMessage))))
+	if err == nil {
+		t.Error("expected error on too long message without line feed")
+	}
+}
+
+// Tests that messages received over TCP and UDP are imported.
+func TestListenSyslog(t *testing.T) {
+	logOut = ioutil.Discard
+	defer func() { *format = presets["nasa"].format }()
+	*format = `$remote_addr - - [$time_local] "$request" $status $size`
+	const line = `10.0.0.1 - - [06/Oct/2016:00:17:09 +0000] "GET /%s HTTP/1.1" 200 612`
+
+	store := &memStore{}
+	tl, err := listenSyslog("tcp://127.0.0.1:0", store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ul, err := listenSyslog("udp://127.0.0.1:0", store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := net.Dial("tcp", tl.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := "<190>Oct  6 00:17:09 web1 nginx: " + strings.Replace(line, "%s", "tcp-octet", 1)
+	_, err = io.WriteString(c, strconv.Itoa(len(msg))+" "+msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.WriteString(c, "<190>Oct  6 00:17:09 web1 nginx: "+strings.Replace(line, "%s", "tcp-lf", 1)+"\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+
+	u, err := net.Dial("udp", ul.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.WriteString(u, "<190>1 2016-10-06T00:17:09Z web2 nginx - - - "+strings.Replace(line, "%s", "udp", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u.Close()
+
+	// Wait for the messages to be received.
+	received := func(l *syslogListener) int64 {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return l.imp.lines
+	}
+	for deadline := time.Now().Add(5 * time.Second); received(tl) < 2 || received(ul) < 1; {
+		if time.Now().After(deadline) {
+			t.Fatalf("received %d TCP and %d UDP messages", received(tl), received(ul))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := tl.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ul.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	uris := store.URIs()
+	sort.Strings(uris)
+	if got := strings.Join(uris, ","); got != "/tcp-lf,/tcp-octet,/udp" {
+		t.Fatalf("unexpected URIs %s", got)
+	}
+	for _, r := range store.reqs {
+		if r.SyslogApp != "nginx" || (r.SyslogHost != "web1" && r.SyslogHost != "web2") || r.StatusCode != 200 {
+			t.Errorf("unexpected request %+v", r)
+		}
+	}
+}
+
+// Tests that a message with a bad field does not stop the listener
+// with the abort policy.
+func TestListenSyslogBadMessage(t *testing.T) {
+	logOut = ioutil.Discard
+	defer func() { *format = presets["nasa"].format }()
+	*format = `$remote_addr - - [$time_local] "$request" $status $size`
+	const line = `<190>Oct  6 00:17:09 web1 nginx: 10.0.0.1 - - [06/Oct/2016:00:17:09 +0000] "GET /%s HTTP/1.1" %s 612`
+
+	store := &memStore{}
+	var ls []*syslogListener
+	for _, addr := range []string{"tcp://127.0.0.1:0", "udp://127.0.0.1:0"} {
+		l, err := listenSyslog(addr, store)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ls = append(ls, l)
+		network := strings.SplitN(addr, ":", 2)[0]
+		for _, msg := range []string{fmt.Sprintf(line, "bad", "2x0"), fmt.Sprintf(line, "good-"+network, "200")} {
+			c, err := net.Dial(network, l.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = io.WriteString(c, msg+"\n")
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.Close()
+		}
+	}
+
+	// Wait for the messages to be received.
+	received := func(l *syslogListener) int64 {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return l.imp.lines
+	}
+	for deadline := time.Now().Add(5 * time.Second); received(ls[0]) < 2 || received(ls[1]) < 2; {
+		if time.Now().After(deadline) {
+			t.Fatalf("received %d TCP and %d UDP messages", received(ls[0]), received(ls[1]))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, l := range ls {
+		if err := l.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if l.imp.rejected["status"] != 1 {
+			t.Errorf("%s: expected 1 rejected message, got %v", l.name, l.imp.rejected)
+		}
+	}
+	uris := store.URIs()
+	sort.Strings(uris)
+	if got := strings.Join(uris, ","); got != "/good-tcp,/good-udp" {
+		t.Fatalf("unexpected URIs %s", got)
+	}
+}
+
+// rejectStore rejects requests for /reject, and
+// returns an error for requests for /down.
+type rejectStore struct {
+	memStore
+}
+
+func (s *rejectStore) StoreAck(r traffic.Request, seq int64, acker traffic.Acker) error {
+	switch r.URI {
+	case "/reject":
+		acker.Ack(traffic.Ack{Failed: []traffic.StoreFailure{{Seq: seq, ID: r.ID, Reason: "mapper_parsing_exception"}}})
+		return nil
+	case "/down":
+		return errors.New("backend unavailable")
+	}
+	return s.memStore.StoreAck(r, seq, acker)
+}
+
+// Tests that a message rejected by the store does not stop the
+// listener, and that an error of the store is reported.
+func TestListenSyslogStoreFailure(t *testing.T) {
+	logOut = ioutil.Discard
+	defer func() { *format = presets["nasa"].format }()
+	*format = `$remote_addr - - [$time_local] "$request" $status $size`
+	const line = `<190>Oct  6 00:17:09 web1 nginx: 10.0.0.1 - - [06/Oct/2016:00:17:09 +0000] "GET /%s HTTP/1.1" 200 612` + "\n"
+
+	store := &rejectStore{}
+	l, err := listenSyslog("tcp://127.0.0.1:0", store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	fmt.Fprintf(c, line, "reject")
+	fmt.Fprintf(c, line, "after")
+	waitURIs(t, &store.memStore, "/after")
+	if _, failed := l.imp.acks.counts(); failed != 1 {
+		t.Errorf("expected 1 failed request, got %d", failed)
+	}
+
+	// The store does not recover, so the listener stops.
+	fmt.Fprintf(c, line, "down")
+	for deadline := time.Now().Add(5 * time.Second); l.imp.pipe.Err() == nil; {
+		if time.Now().After(deadline) {
+			t.Fatal("the store error was not returned")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	fmt.Fprintf(c, line, "next")
+	select {
+	case err := <-l.Failed():
+		if err == nil || !strings.Contains(err.Error(), "backend unavailable") {
+			t.Errorf("unexpected error %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the listener did not stop")
+	}
+	if err := l.Close(); err == nil {
+		t.Error("expected the store error from Close")
+	}
+}
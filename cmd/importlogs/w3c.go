@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/satyrius/gonx"
+)
+
+// directiveParser is a parser for formats where the fields are declared
+// by directive lines in the file, for example "#Fields:" in W3C logs.
+// Parsers are not modified, so they can be used concurrently.
+type directiveParser interface {
+	gonx.StringParser
+
+	// Directive returns the parser for the lines after a directive line.
+	Directive(line string) (gonx.StringParser, error)
+}
+
+// isDirective returns true if the line is a directive.
+func isDirective(line string) bool {
+	return strings.HasPrefix(line, "#")
+}
+
+// w3cFields maps W3C extended log fields to field names.
+// Header fields, like cs(User-Agent), are named as nginx does.
+// Other fields are named with '-' replaced by '_'.
+// See https://www.w3.org/TR/WD-logfile.html
+var w3cFields = map[string]string{
+	"c-ip":           "remote_addr",
+	"cs-username":    "remote_user",
+	"cs-method":      "method",
+	"cs-uri-stem":    "uri",
+	"cs-uri":         "uri",
+	"cs-version":     "protocol",
+	"cs-host":        "host",
+	"s-ip":           "server_addr",
+	"s-port":         "server_port",
+	"sc-status":      "status",
+	"sc-bytes":       "bytes_sent",
+	"cs-bytes":       "bytes_received",
+	"time-taken":     "request_time",
+	"x-request-id":   "request_id",
+	"s-sitename":     "site_name",
+	"s-computername": "server_hostname",
+}
+
+// w3cParser parses W3C extended logs, as written by IIS.
+type w3cParser struct {
+	fields []string // Field names of the columns.
+	date   string   // Date of the #Date directive, used if lines have no date.
+	iis    bool     // Logs are written by IIS.
+
+	cloudFront bool // Logs are written by CloudFront.
+}
+
+// newW3CParser returns a parser for W3C extended logs.
+// Lines are rejected until a #Fields directive is found.
+func newW3CParser() gonx.StringParser {
+	return &w3cParser{}
+}
+
+// Directive returns a parser that applies a #Fields, #Date or #Software
+// directive. Other directives are ignored.
+func (p *w3cParser) Directive(line string) (gonx.StringParser, error) {
+	i := strings.IndexByte(line, ':')
+	if i < 0 {
+		return p, nil
+	}
+	name, value := line[1:i], strings.TrimSpace(line[i+1:])
+	np := *p
+	switch name {
+	case "Fields":
+		np.fields = nil
+		for _, f := range strings.Fields(value) {
+			np.fields = append(np.fields, p.field(f))
+		}
+	case "Date":
+		// The date and time the log was started, for example "2002-05-24 20:18:01".
+		d := strings.Fields(value)
+		if len(d) == 0 {
+			return nil, fmt.Errorf("no date in #Date directive")
+		}
+		np.date = d[0]
+	case "Software":
+		// IIS writes spaces in headers as '+', and time-taken in milliseconds.
+		np.iis = strings.Contains(value, "Internet Information Services")
+	}
+	return &np, nil
+}
+
+// field returns the field name of a W3C field.
+func (p *w3cParser) field(s string) string {
+	if name, ok := cloudFrontFields[s]; ok && p.cloudFront {
+		return name
+	}
+	if name, ok := w3cFields[s]; ok {
+		return name
+	}
+	// Header fields, for example cs(User-Agent).
+	if i := strings.IndexByte(s, '('); i > 0 && strings.HasSuffix(s, ")") {
+		prefix, header := s[:i], headerName(s[i+1:len(s)-1])
+		switch prefix {
+		case "cs":
+			return "http_" + header
+		case "sc":
+			return "sent_http_" + header
+		}
+	}
+	return strings.Replace(strings.ToLower(s), "-", "_", -1)
+}
+
+// ParseString parses a line with the columns of the last #Fields directive.
+func (p *w3cParser) ParseString(line string) (*gonx.Entry, error) {
+	if p.fields == nil {
+		return nil, fmt.Errorf("no #Fields directive before line")
+	}
+	var values []string
+	if p.cloudFront {
+		values = cloudFrontSplit(line)
+	} else {
+		var err error
+		values, err = w3cSplit(line)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(values) != len(p.fields) {
+		return nil, fmt.Errorf("line has %d fields, #Fields declares %d", len(values), len(p.fields))
+	}
+	entry := gonx.NewEmptyEntry()
+	for i, name := range p.fields {
+		v := values[i]
+		if p.iis && strings.HasPrefix(name, "http_") {
+			v = strings.Replace(v, "+", " ", -1)
+		}
+		if p.cloudFront && strings.HasPrefix(name, "http_") {
+			v = urlDecode(v)
+		}
+		entry.SetField(name, v)
+	}
+
+	// Date and time are separate fields in UTC.
+	date, err := entry.Field("date")
+	if err != nil {
+		date = p.date
+	}
+	if t, err := entry.Field("time"); err == nil && date != "" {
+		entry.SetField("time_iso8601", date+"T"+t+"Z")
+	}
+	if q, err := entry.Field("cs_uri_query"); err == nil && q != "-" && q != "" {
+		if uri, err := entry.Field("uri"); err == nil {
+			entry.SetField("uri", uri+"?"+q)
+		}
+	}
+	if p.iis {
+		if t, err := entry.Field("request_time"); err == nil {
+			entry.SetField("request_time", "-")
+			entry.SetField("request_time_ms", t)
+		}
+	}
+	return entry, nil
+}
+
+// w3cSplit splits a line into values separated by spaces.
+// Values may be quoted, where quotes are escaped by doubling them.
+func w3cSplit(line string) ([]string, error) {
+	var values []string
+	for i := 0; i < len(line); {
+		switch line[i] {
+		case ' ', '\t':
+			i++
+		case '"':
+			var b []byte
+			i++
+			for {
+				if i == len(line) {
+					return nil, fmt.Errorf("unterminated quoted value")
+				}
+				if line[i] == '"' {
+					if i+1 < len(line) && line[i+1] == '"' {
+						b = append(b, '"')
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				b = append(b, line[i])
+				i++
+			}
+			values = append(values, string(b))
+		default:
+			start := i
+			for i < len(line) && line[i] != ' ' && line[i] != '\t' {
+				i++
+			}
+			values = append(values, line[start:i])
+		}
+	}
+	return values, nil
+}
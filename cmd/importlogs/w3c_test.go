@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testW3C = `#Software: Microsoft Internet Information Services 8.5
+#Version: 1.0
+#Date: 2016-03-01 00:00:00
+#Fields: date time s-ip cs-method cs-uri-stem cs-uri-query s-port cs-username c-ip cs(User-Agent) cs(Referer) sc-status sc-substatus sc-win32-status time-taken
+2016-03-01 00:00:01 10.0.0.1 GET /a.aspx id=1 80 - 192.168.0.1 Mozilla/5.0+(Windows+NT+10.0) - 200 0 0 15
+2016-03-01 00:00:02 10.0.0.1 POST /b.aspx - 443 bob 192.168.0.2 curl/7.47.0 http://example.com/ 404 0 2 250
+#Software: Microsoft Internet Information Services 8.5
+#Version: 1.0
+#Date: 2016-03-01 00:00:03
+#Fields: time c-ip cs-method cs-uri-stem sc-status sc-bytes
+00:00:03 192.168.0.3 GET /c.html 304 120
+`
+
+// Tests that W3C logs are read with the fields declared in the file.
+func TestW3C(t *testing.T) {
+	logOut = ioutil.Discard
+	defer func() { *inputName = "" }()
+	*inputName = "w3c"
+
+	dir, err := ioutil.TempDir("", "importlogs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := writeLog(t, dir, testW3C)
+
+	store := &memStore{}
+	err = importFile(name, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(store.URIs(), ","); got != "/a.aspx?id=1,/b.aspx,/c.html" {
+		t.Fatalf("unexpected URIs %s", got)
+	}
+	a, b, c := store.reqs[0], store.reqs[1], store.reqs[2]
+	if !a.ServerTime.Equal(time.Date(2016, 3, 1, 0, 0, 1, 0, time.UTC)) || a.Remote != "192.168.0.1" || a.UserAgent != "Mozilla/5.0 (Windows NT 10.0)" || a.RequestTime != 0.015 {
+		t.Errorf("unexpected request %+v", a)
+	}
+	if b.Method != "POST" || b.StatusCode != 404 || b.RemoteUser != "bob" || b.Referer != "http://example.com/" {
+		t.Errorf("unexpected request %+v", b)
+	}
+	if !c.ServerTime.Equal(time.Date(2016, 3, 1, 0, 0, 3, 0, time.UTC)) || c.StatusCode != 304 || c.Payload != 120 {
+		t.Errorf("unexpected request %+v", c)
+	}
+
+	// Resuming after the second #Fields directive must apply it.
+	f := newFileImport(name, store)
+	fi, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fi.Close()
+	_, err = f.resume(fi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := bufio.NewReader(fi)
+	err = f.skipLines(r, int64(strings.LastIndex(testW3C, "00:00:03 ")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := f.parser.ParseString("00:00:04 192.168.0.4 GET /d.html 200 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := parseEntry(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.URI != "/d.html" || !req.ServerTime.Equal(time.Date(2016, 3, 1, 0, 0, 4, 0, time.UTC)) {
+		t.Errorf("unexpected request %+v", req)
+	}
+	f.finish()
+}
+
+func TestW3CSplit(t *testing.T) {
+	got, err := w3cSplit(`a "b c" "say ""hi""" -`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, "|") != `a|b c|say "hi"|-` {
+		t.Fatalf("unexpected split %q", got)
+	}
+	_, err = w3cSplit(`a "b`)
+	if err == nil {
+		t.Fatal("expected error on unterminated value")
+	}
+}
@@ -0,0 +1,119 @@
+package decompress
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+
+	"github.com/klauspost/pgzip"
+)
+
+// Decompressor returns a reader that will decompress r.
+type Decompressor func(r io.Reader) (io.ReadCloser, error)
+
+// format is a registered compression format.
+type format struct {
+	name  string
+	magic []byte
+	fn    Decompressor
+}
+
+// Registered formats, sorted by descending magic length.
+var (
+	formats   []format
+	formatsMu sync.RWMutex
+)
+
+func init() {
+	Register("gzip", func(r io.Reader) (io.ReadCloser, error) {
+		return pgzip.NewReader(r)
+	}, []byte{0x1f, 0x8b})
+
+	Register("bzip2", func(r io.Reader) (io.ReadCloser, error) {
+		return ioutil.NopCloser(bzip2.NewReader(r)), nil
+	}, []byte("BZh1"), []byte("BZh2"), []byte("BZh3"), []byte("BZh4"),
+		[]byte("BZh5"), []byte("BZh6"), []byte("BZh7"), []byte("BZh8"), []byte("BZh9"))
+
+	// zlib headers with deflate and a 32K window at all compression levels.
+	Register("zlib", zlib.NewReader,
+		[]byte{0x78, 0x01}, []byte{0x78, 0x5e}, []byte{0x78, 0x9c}, []byte{0x78, 0xda})
+}
+
+// Register a decompressor for streams starting with any of the magic values.
+// If several formats match a stream, the longest magic value is used.
+// Registering a magic value again replaces the previous decompressor.
+func Register(name string, fn Decompressor, magic ...[]byte) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+	for _, m := range magic {
+		f := format{name: name, magic: m, fn: fn}
+		replaced := false
+		for i := range formats {
+			if bytes.Equal(formats[i].magic, m) {
+				formats[i] = f
+				replaced = true
+			}
+		}
+		if !replaced {
+			formats = append(formats, f)
+		}
+	}
+	sort.Stable(byMagicLen(formats))
+}
+
+// byMagicLen sorts formats by descending magic length.
+type byMagicLen []format
+
+func (b byMagicLen) Len() int           { return len(b) }
+func (b byMagicLen) Less(i, j int) bool { return len(b[i].magic) > len(b[j].magic) }
+func (b byMagicLen) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+
+// Detect returns the name and decompressor of the format
+// matching the start of a stream.
+// If no format matches, ok is false.
+func Detect(head []byte) (name string, fn Decompressor, ok bool) {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	for _, f := range formats {
+		if bytes.HasPrefix(head, f.magic) {
+			return f.name, f.fn, true
+		}
+	}
+	return "", nil, false
+}
+
+// NewReader returns a reader that decompresses r using the format
+// detected from the first bytes of the stream, and the name of the format.
+// If no format is detected, the content is returned unmodified,
+// and the name is empty.
+//
+// The returned reader buffers input and may read more data than
+// necessary from r. The caller should call Close on the reader when done.
+func NewReader(r io.Reader) (rc io.ReadCloser, name string, err error) {
+	formatsMu.RLock()
+	n := 0
+	if len(formats) > 0 {
+		n = len(formats[0].magic)
+	}
+	formatsMu.RUnlock()
+
+	br := bufio.NewReader(r)
+	head, err := br.Peek(n)
+	if err != nil && err != io.EOF {
+		return nil, "", err
+	}
+	name, fn, ok := Detect(head)
+	if !ok {
+		return ioutil.NopCloser(br), "", nil
+	}
+	rc, err = fn(br)
+	if err != nil {
+		return nil, name, err
+	}
+	return rc, name, nil
+}
@@ -0,0 +1,108 @@
+package decompress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+const content = "line one\nline two\n"
+
+// gzipped returns the content compressed as a single gzip member.
+func gzipped(t *testing.T, s string) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write([]byte(s))
+	err := w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestNewReader(t *testing.T) {
+	var zbuf bytes.Buffer
+	zw := zlib.NewWriter(&zbuf)
+	zw.Write([]byte(content))
+	zw.Close()
+
+	bz, err := ioutil.ReadFile("testdata/lines.txt.bz2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Two gzip members must be read as one stream.
+	multi := append(gzipped(t, "line one\n"), gzipped(t, "line two\n")...)
+
+	tests := []struct {
+		name string
+		in   []byte
+	}{
+		{name: "", in: []byte(content)},
+		{name: "gzip", in: gzipped(t, content)},
+		{name: "gzip", in: multi},
+		{name: "zlib", in: zbuf.Bytes()},
+		{name: "bzip2", in: bz},
+	}
+	for i, test := range tests {
+		r, name, err := NewReader(bytes.NewReader(test.in))
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		if name != test.name {
+			t.Fatalf("test %d: expected format %q, got %q", i, test.name, name)
+		}
+		got, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		r.Close()
+		if string(got) != content {
+			t.Fatalf("test %d: expected %q, got %q", i, content, string(got))
+		}
+	}
+}
+
+// Test that short and empty plain streams are returned.
+func TestNewReaderShort(t *testing.T) {
+	for _, s := range []string{"", "a", "BZh"} {
+		r, name, err := NewReader(strings.NewReader(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := ioutil.ReadAll(r)
+		if name != "" || string(got) != s {
+			t.Fatalf("expected plain %q, got %q (%q)", s, string(got), name)
+		}
+	}
+}
+
+// Test that registered formats are used, and that
+// the longest magic value takes precedence.
+func TestRegister(t *testing.T) {
+	Register("upper", func(r io.Reader) (io.ReadCloser, error) {
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(strings.NewReader(strings.ToUpper(string(b[len("UPPER\n"):])))), nil
+	}, []byte("UPPER\n"))
+
+	r, name, err := NewReader(strings.NewReader("UPPER\nabc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := ioutil.ReadAll(r)
+	if name != "upper" || string(got) != "ABC" {
+		t.Fatalf("expected upper ABC, got %s %q", name, string(got))
+	}
+
+	name, _, ok := Detect([]byte{0x1f, 0x8b, 0x08})
+	if !ok || name != "gzip" {
+		t.Fatalf("expected gzip, got %q", name)
+	}
+}
@@ -0,0 +1,6 @@
+// Package decompress detects the compression of a stream and decompresses it.
+//
+// Formats are detected by the magic bytes at the start of the stream.
+// gzip (including multi-member files), bzip2 and zlib are registered
+// by default. Other formats can be added with Register.
+package decompress
@@ -0,0 +1,201 @@
+package decompress
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+)
+
+// SalvageStats describes the damage found by a SalvageReader.
+//
+// Lines that were compressed in the skipped data cannot be counted,
+// since they cannot be decoded.
+type SalvageStats struct {
+	Damaged      int   // Number of damaged regions.
+	SkippedBytes int64 // Compressed bytes that could not be decoded.
+	LostLines    int   // Incomplete lines discarded at damaged regions.
+	LostBytes    int64 // Decompressed size of the discarded lines.
+}
+
+// gzipMagic is the start of a gzip member header with deflate compression.
+var gzipMagic = []byte{0x1f, 0x8b, 0x08}
+
+// SalvageReader decompresses a gzip file, where some members may
+// be truncated or corrupted.
+//
+// All complete lines decoded before damage is found are returned.
+// The incomplete line at the damage is discarded, and decoding is
+// resumed at the next gzip member header found after the start of
+// the damaged member.
+type SalvageReader struct {
+	r    io.ReaderAt
+	size int64
+	pos  int64 // Start of the current member.
+	cr   *countReader
+	gz   *gzip.Reader
+
+	ready     []byte // Complete lines that can be returned.
+	tail      []byte // Decoded data after the last line feed.
+	scratch   []byte
+	damagedAt int64 // Compressed offset where decoding failed. -1 if decoding succeeds.
+	err       error
+	stats     SalvageStats
+}
+
+// NewSalvageReader returns a reader that decompresses the gzip file
+// in r of the given size, skipping damaged data.
+func NewSalvageReader(r io.ReaderAt, size int64) *SalvageReader {
+	return &SalvageReader{r: r, size: size, damagedAt: -1, scratch: make([]byte, 64<<10)}
+}
+
+// Stats returns the damage found so far.
+func (s *SalvageReader) Stats() SalvageStats {
+	return s.stats
+}
+
+// Read decompressed data.
+func (s *SalvageReader) Read(p []byte) (int, error) {
+	for len(s.ready) == 0 {
+		if s.err != nil {
+			return 0, s.err
+		}
+		s.fill()
+	}
+	n := copy(p, s.ready)
+	s.ready = s.ready[n:]
+	return n, nil
+}
+
+// Close does nothing. The underlying reader must be closed by the caller.
+func (s *SalvageReader) Close() error {
+	return nil
+}
+
+// fill will decode the next block of data,
+// and handle the end of members and damage.
+func (s *SalvageReader) fill() {
+	if s.gz == nil {
+		err := s.start(s.pos)
+		if err == io.EOF {
+			s.finish()
+			return
+		}
+		if err != nil {
+			s.damage(s.pos)
+		}
+		return
+	}
+	n, err := s.gz.Read(s.scratch)
+	if n > 0 {
+		if s.damagedAt >= 0 {
+			// Decoding has resumed.
+			if s.pos > s.damagedAt {
+				s.stats.SkippedBytes += s.pos - s.damagedAt
+			}
+			s.damagedAt = -1
+		}
+		data := append(s.tail, s.scratch[:n]...)
+		i := bytes.LastIndexByte(data, '\n') + 1
+		s.ready = data[:i]
+		s.tail = append([]byte(nil), data[i:]...)
+	}
+	switch err {
+	case nil:
+	case io.EOF:
+		// The member ended. The next member starts after it.
+		s.pos += s.cr.n
+		s.gz = nil
+	default:
+		s.damage(s.pos + s.cr.n)
+	}
+}
+
+// start will start decoding a member at the offset.
+func (s *SalvageReader) start(offset int64) error {
+	s.pos = offset
+	s.cr = &countReader{r: bufio.NewReader(io.NewSectionReader(s.r, offset, s.size-offset))}
+	var err error
+	s.gz, err = gzip.NewReader(s.cr)
+	if err != nil {
+		s.gz = nil
+		return err
+	}
+	s.gz.Multistream(false)
+	return nil
+}
+
+// damage will register damage found at the offset, discard the
+// incomplete line and continue at the next member header.
+func (s *SalvageReader) damage(offset int64) {
+	if s.damagedAt < 0 {
+		s.stats.Damaged++
+		if offset > s.size {
+			offset = s.size
+		}
+		s.damagedAt = offset
+	}
+	if len(s.tail) > 0 {
+		s.stats.LostLines++
+		s.stats.LostBytes += int64(len(s.tail))
+		s.tail = nil
+	}
+	s.gz = nil
+	next := s.search(s.pos + 1)
+	if next < 0 {
+		s.finish()
+		return
+	}
+	s.pos = next
+}
+
+// search returns the offset of the next gzip member
+// header at or after the offset, or -1 if none is found.
+func (s *SalvageReader) search(offset int64) int64 {
+	buf := make([]byte, len(s.scratch))
+	for offset < s.size {
+		n, err := s.r.ReadAt(buf, offset)
+		if i := bytes.Index(buf[:n], gzipMagic); i >= 0 {
+			return offset + int64(i)
+		}
+		if err != nil || n < len(gzipMagic) {
+			return -1
+		}
+		// Overlap, so headers crossing the buffer boundary are found.
+		offset += int64(n - len(gzipMagic) + 1)
+	}
+	return -1
+}
+
+// finish will return the remaining data and end the stream.
+func (s *SalvageReader) finish() {
+	if s.damagedAt >= 0 && s.size > s.damagedAt {
+		s.stats.SkippedBytes += s.size - s.damagedAt
+	}
+	s.damagedAt = -1
+	s.ready = s.tail
+	s.tail = nil
+	s.err = io.EOF
+}
+
+// countReader counts the bytes read.
+// It implements io.ByteReader, so the gzip reader will not
+// read ahead, and the count is the exact size of the member.
+type countReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
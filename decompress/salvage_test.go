@@ -0,0 +1,96 @@
+package decompress
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// members returns n gzip members with the number of lines in each,
+// and the offset of each member.
+func members(t *testing.T, n, lines int) ([]byte, []int) {
+	var all []byte
+	var offsets []int
+	for m := 0; m < n; m++ {
+		var content []string
+		for i := 0; i < lines; i++ {
+			content = append(content, fmt.Sprintf("member %d line %d with some content to compress", m, i))
+		}
+		offsets = append(offsets, len(all))
+		all = append(all, gzipped(t, strings.Join(content, "\n")+"\n")...)
+	}
+	return all, offsets
+}
+
+// salvage reads all content with a SalvageReader.
+func salvage(t *testing.T, b []byte) (string, SalvageStats) {
+	s := NewSalvageReader(bytes.NewReader(b), int64(len(b)))
+	got, err := ioutil.ReadAll(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(got), s.Stats()
+}
+
+// Tests that undamaged files are read completely.
+func TestSalvageIntact(t *testing.T) {
+	b, _ := members(t, 3, 100)
+	got, stats := salvage(t, b)
+	if strings.Count(got, "\n") != 300 {
+		t.Fatalf("expected 300 lines, got %d", strings.Count(got, "\n"))
+	}
+	if stats != (SalvageStats{}) {
+		t.Fatalf("expected no damage, got %+v", stats)
+	}
+}
+
+// Tests that a corrupt member is skipped and
+// decoding resumes at the next member.
+func TestSalvageCorrupt(t *testing.T) {
+	b, offsets := members(t, 3, 100)
+	// Corrupt the deflate data of the second member.
+	for i := offsets[1] + 30; i < offsets[1]+40; i++ {
+		b[i] = 0xff
+	}
+	got, stats := salvage(t, b)
+	if !strings.HasPrefix(got, "member 0 line 0 ") {
+		t.Fatal("first member was not decoded")
+	}
+	if !strings.Contains(got, "member 2 line 0 ") || !strings.HasSuffix(got, "member 2 line 99 with some content to compress\n") {
+		t.Fatal("third member was not decoded")
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(got, "\n"), "\n") {
+		if !strings.HasSuffix(line, " with some content to compress") {
+			t.Fatalf("incomplete line returned: %q", line)
+		}
+	}
+	if stats.Damaged != 1 {
+		t.Fatalf("expected 1 damaged region, got %+v", stats)
+	}
+	if stats.SkippedBytes <= 0 || stats.SkippedBytes > int64(offsets[2]-offsets[1]) {
+		t.Fatalf("unexpected skipped bytes: %+v", stats)
+	}
+}
+
+// Tests that a truncated file returns all complete lines.
+func TestSalvageTruncated(t *testing.T) {
+	// The flate decoder returns data in 32KB blocks,
+	// so the member must be larger than that.
+	b, offsets := members(t, 2, 5000)
+	b = b[:offsets[1]+(len(b)-offsets[1])/2]
+	got, stats := salvage(t, b)
+	if !strings.Contains(got, "member 1 line 0 ") {
+		t.Fatal("truncated member was not decoded")
+	}
+	if strings.Count(got, "\n") >= 10000 {
+		t.Fatal("expected lines to be lost")
+	}
+	if !strings.HasSuffix(got, "with some content to compress\n") {
+		t.Fatalf("incomplete line returned: %q", got[len(got)-20:])
+	}
+	if stats.Damaged != 1 || stats.LostLines != 1 || stats.LostBytes == 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
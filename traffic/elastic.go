@@ -3,6 +3,7 @@ package traffic
 import (
 	"fmt"
 	"log"
+	"time"
 
 	"gopkg.in/olivere/elastic.v3"
 )
@@ -14,9 +15,20 @@ type elasticStore struct {
 	index  string
 
 	// Used for the async saver
-	queue    chan *Request
+	queue    chan *queued
+	flush    chan chan struct{}
 	finished chan struct{}
 	err      *syncErr
+	batch    []*queued // Requests in the current bulk request.
+}
+
+// queued is a request waiting to be sent.
+type queued struct {
+	r     *Request
+	e     *ErrorEntry // Set instead of r for error log entries.
+	id    string
+	seq   int64
+	acker Acker // nil if the request should not be acknowledged
 }
 
 // NewElastic will return a RequestStore, that will
@@ -29,9 +41,14 @@ type elasticStore struct {
 //
 // If an error has been encountered, the storer will not recover.
 // If Close returns successfully all requests are stored successfully.
-func NewElastic(host, index string) (RequestStore, error) {
+//
+// Use StoreAck to be notified about the result of each request.
+// Documents that elastic rejects are reported to their acker,
+// and are not an error of the storer.
+func NewElastic(host, index string) (AckStore, error) {
 	e := &elasticStore{index: index, err: &syncErr{}}
-	e.queue = make(chan *Request, 1000)
+	e.queue = make(chan *queued, 1000)
+	e.flush = make(chan chan struct{})
 	e.finished = make(chan struct{}, 0)
 
 	// Create elastic client
@@ -59,59 +76,176 @@ func NewElastic(host, index string) (RequestStore, error) {
 // stored even if nil is returned, and that any error returned are
 // likely from a previous store.
 func (e *elasticStore) Store(r Request) error {
-	e.queue <- &r
+	e.queue <- &queued{r: &r}
 	return e.err.Err()
 }
 
+// StoreAck will store a request in elastic.
+//
+// The acker is called when the bulk request containing the
+// request has been sent, with the result for each document.
+func (e *elasticStore) StoreAck(r Request, seq int64, acker Acker) error {
+	e.queue <- &queued{r: &r, seq: seq, acker: acker}
+	return e.err.Err()
+}
+
+// StoreError will store an error log entry in elastic.
+//
+// Entries are stored in bulk requests with the requests, and are
+// acknowledged as StoreAck. If acker is nil, the entry is not acknowledged.
+func (e *elasticStore) StoreError(entry ErrorEntry, seq int64, acker Acker) error {
+	e.queue <- &queued{e: &entry, seq: seq, acker: acker}
+	return e.err.Err()
+}
+
+// flushInterval is the maximum time a request will be
+// queued before the bulk request is sent.
+const flushInterval = 5 * time.Second
+
 // startSaver will start an async saver
 func (e *elasticStore) startSaver() {
 	// When this function returns, always close the finished channel
 	defer close(e.finished)
 
+	// Send pending requests regularly, so slowly arriving
+	// requests are not held back.
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
 	bulk := elastic.NewBulkService(e.client)
 	for {
-		// Get item of the queue
-		r, ok := <-e.queue
+		var q *queued
+		var ok bool
+		select {
+		case q, ok = <-e.queue:
+		case done := <-e.flush:
+			// Add the requests queued before the flush and send them.
+			for len(e.queue) > 0 {
+				e.addBulk(bulk, <-e.queue)
+			}
+			if bulk.NumberOfActions() > 0 && !e.sendBulk(bulk) {
+				close(done)
+				return
+			}
+			close(done)
+			continue
+		case <-ticker.C:
+			if bulk.NumberOfActions() > 0 && !e.sendBulk(bulk) {
+				return
+			}
+			continue
+		}
 
 		// If channel was closed, store the rest and return
 		if !ok {
 			if bulk.NumberOfActions() == 0 {
 				return
 			}
-			res, err := bulk.Do()
-			e.err.Set(err)
-			if res != nil && res.Errors {
-				e.err.Set(fmt.Errorf("bulk index has error. %d failed, %d succeeded", len(res.Failed()), len(res.Succeeded())))
-			}
+			e.sendBulk(bulk)
 			return
 		}
-		// Remove ID, ES has that as a separate field
-		id := r.ID
-		r.ID = ""
+		e.addBulk(bulk, q)
 
-		// Get destination index based on the Request
-		index := r.Index(e.index)
+		// If we have collected 500 documents, send the request.
+		if bulk.NumberOfActions() >= 500 && !e.sendBulk(bulk) {
+			return
+		}
+	}
+}
 
-		// Create the request and add it to the bulk saver
-		req := elastic.NewBulkIndexRequest().Index(index).Type("request").Id(id).Doc(r)
+// addBulk will add a request to the bulk request.
+func (e *elasticStore) addBulk(bulk *elastic.BulkService, q *queued) {
+	if q.e != nil {
+		entry := q.e
+		q.id = entry.ID
+		entry.ID = ""
+		req := elastic.NewBulkIndexRequest().Index(entry.Index(e.index)).Type("error").Id(q.id).Doc(entry)
 		bulk.Add(req)
+		e.batch = append(e.batch, q)
+		return
+	}
 
-		// If we have collected 500 documents, send the request.
-		if bulk.NumberOfActions() >= 500 {
-			// BulkService.Do() resets the request, so we can reuse it.
-			res, err := bulk.Do()
-			if err != nil {
-				e.err.Set(err)
-				return
+	// Remove ID, ES has that as a separate field
+	r := q.r
+	q.id = r.ID
+	r.ID = ""
+
+	// Get destination index based on the Request
+	index := r.Index(e.index)
+
+	// Create the request and add it to the bulk saver
+	req := elastic.NewBulkIndexRequest().Index(index).Type("request").Id(q.id).Doc(r)
+	bulk.Add(req)
+	e.batch = append(e.batch, q)
+}
+
+// sendBulk will send the bulk request and acknowledge the requests.
+// BulkService.Do() resets the request, so it can be reused.
+// If the request could not be sent, false is returned.
+func (e *elasticStore) sendBulk(bulk *elastic.BulkService) bool {
+	res, err := bulk.Do()
+	unacked := ackBulk(e.batch, res, err)
+	e.batch = e.batch[:0]
+	if err != nil {
+		e.err.Set(err)
+		return false
+	}
+	if res.Errors && unacked > 0 {
+		e.err.Set(fmt.Errorf("bulk index returned error(s). %d failed, %d succeeded", len(res.Failed()), len(res.Succeeded())))
+	}
+	return true
+}
+
+// ackBulk will send acknowledgements for the requests in a batch.
+// Each acker is called once with the result of its requests.
+// If err is set, all requests have failed.
+// The number of failed requests without an acker is returned.
+func ackBulk(batch []*queued, res *elastic.BulkResponse, err error) (unacked int) {
+	acks := make(map[Acker]*Ack)
+	var ackers []Acker
+	for i, q := range batch {
+		// Responses are in the same order as the requests.
+		var reason string
+		switch {
+		case err != nil:
+			reason = err.Error()
+		case res == nil || i >= len(res.Items):
+			reason = "no response for document"
+		default:
+			for _, item := range res.Items[i] {
+				if item.Error != nil {
+					reason = item.Error.Type + ": " + item.Error.Reason
+				} else if item.Status >= 300 {
+					reason = fmt.Sprintf("status %d", item.Status)
+				}
 			}
-			if res.Errors {
-				e.err.Set(fmt.Errorf("bulk index returned error(s). %d failed, %d succeeded", len(res.Failed()), len(res.Succeeded())))
+		}
+		if q.acker == nil {
+			if reason != "" {
+				unacked++
 			}
+			continue
 		}
+		a, ok := acks[q.acker]
+		if !ok {
+			a = &Ack{}
+			acks[q.acker] = a
+			ackers = append(ackers, q.acker)
+		}
+		if reason != "" {
+			a.Failed = append(a.Failed, StoreFailure{Seq: q.seq, ID: q.id, Reason: reason})
+			continue
+		}
+		a.Stored = append(a.Stored, q.seq)
+	}
+	for _, acker := range ackers {
+		acker.Ack(*acks[acker])
 	}
+	return unacked
 }
 
-// createTemplate will create/update a template for new indexes
+// createTemplate will create/update a template for new indexes.
+// The template has mappings for requests and error log entries.
 // See https://www.elastic.co/guide/en/elasticsearch/guide/current/index-templates.html
 func (e elasticStore) createTemplate() error {
 	t := map[string]interface{}{
@@ -145,6 +279,158 @@ func (e elasticStore) createTemplate() error {
 						"type":  "string",
 						"index": "not_analyzed",
 					},
+					"remote_user": map[string]interface{}{
+						"type":  "string",
+						"index": "not_analyzed",
+					},
+					"referer": map[string]interface{}{
+						"type":  "string",
+						"index": "not_analyzed",
+					},
+					"user_agent": map[string]interface{}{
+						"type":  "string",
+						"index": "not_analyzed",
+					},
+					"vhost": map[string]interface{}{
+						"type":  "string",
+						"index": "not_analyzed",
+					},
+					"request_time": map[string]interface{}{
+						"type": "double",
+					},
+					"upstream_response_time": map[string]interface{}{
+						"type": "double",
+					},
+					"upstream_addr": map[string]interface{}{
+						"type":  "string",
+						"index": "not_analyzed",
+					},
+					"forwarded_for": map[string]interface{}{
+						"type":  "string",
+						"index": "not_analyzed",
+					},
+					"request_id": map[string]interface{}{
+						"type":  "string",
+						"index": "not_analyzed",
+					},
+					"malformed_request": map[string]interface{}{
+						"type": "boolean",
+					},
+					"upstream_status": map[string]interface{}{
+						"type": "integer",
+					},
+					"ssl_protocol": map[string]interface{}{
+						"type":  "string",
+						"index": "not_analyzed",
+					},
+					"ssl_cipher": map[string]interface{}{
+						"type":  "string",
+						"index": "not_analyzed",
+					},
+					"edge_location": map[string]interface{}{
+						"type":  "string",
+						"index": "not_analyzed",
+					},
+					"frontend": map[string]interface{}{
+						"type":  "string",
+						"index": "not_analyzed",
+					},
+					"backend": map[string]interface{}{
+						"type":  "string",
+						"index": "not_analyzed",
+					},
+					"server": map[string]interface{}{
+						"type":  "string",
+						"index": "not_analyzed",
+					},
+					"response_flags": map[string]interface{}{
+						"type":  "string",
+						"index": "not_analyzed",
+					},
+					"cache_result": map[string]interface{}{
+						"type":  "string",
+						"index": "not_analyzed",
+					},
+					"hierarchy": map[string]interface{}{
+						"type":  "string",
+						"index": "not_analyzed",
+					},
+					"dest_host": map[string]interface{}{
+						"type":  "string",
+						"index": "not_analyzed",
+					},
+					"haproxy": map[string]interface{}{
+						"properties": map[string]interface{}{
+							"termination_state": map[string]interface{}{
+								"type":  "string",
+								"index": "not_analyzed",
+							},
+							"request_ms": map[string]interface{}{
+								"type": "integer",
+							},
+							"queue_ms": map[string]interface{}{
+								"type": "integer",
+							},
+							"connect_ms": map[string]interface{}{
+								"type": "integer",
+							},
+							"response_ms": map[string]interface{}{
+								"type": "integer",
+							},
+							"active_ms": map[string]interface{}{
+								"type": "integer",
+							},
+							"actconn": map[string]interface{}{
+								"type": "integer",
+							},
+							"feconn": map[string]interface{}{
+								"type": "integer",
+							},
+							"beconn": map[string]interface{}{
+								"type": "integer",
+							},
+							"srv_conn": map[string]interface{}{
+								"type": "integer",
+							},
+							"retries": map[string]interface{}{
+								"type": "integer",
+							},
+							"srv_queue": map[string]interface{}{
+								"type": "integer",
+							},
+							"backend_queue": map[string]interface{}{
+								"type": "integer",
+							},
+						},
+					},
+					"syslog_host": map[string]interface{}{
+						"type":  "string",
+						"index": "not_analyzed",
+					},
+					"syslog_app": map[string]interface{}{
+						"type":  "string",
+						"index": "not_analyzed",
+					},
+					"container": map[string]interface{}{
+						"properties": map[string]interface{}{
+							"namespace": map[string]interface{}{
+								"type":  "string",
+								"index": "not_analyzed",
+							},
+							"pod": map[string]interface{}{
+								"type":  "string",
+								"index": "not_analyzed",
+							},
+							"name": map[string]interface{}{
+								"type":  "string",
+								"index": "not_analyzed",
+							},
+							"id": map[string]interface{}{
+								"type":  "string",
+								"index": "not_analyzed",
+							},
+						},
+					},
 					"country": map[string]interface{}{
 						"type":  "string",
 						"index": "not_analyzed",
@@ -166,6 +452,34 @@ func (e elasticStore) createTemplate() error {
 					},
 				},
 			},
+			"error": map[string]interface{}{
+				"properties": map[string]interface{}{
+					"time": map[string]interface{}{
+						"type": "date",
+					},
+					"level": map[string]interface{}{
+						"type":  "string",
+						"index": "not_analyzed",
+					},
+					"module": map[string]interface{}{
+						"type":  "string",
+						"index": "not_analyzed",
+					},
+					"pid": map[string]interface{}{
+						"type": "integer",
+					},
+					"tid": map[string]interface{}{
+						"type": "long",
+					},
+					"client": map[string]interface{}{
+						"type":  "string",
+						"index": "not_analyzed",
+					},
+					"message": map[string]interface{}{
+						"type": "string",
+					},
+				},
+			},
 		},
 	}
 	_, err := e.client.IndexPutTemplate(e.index).BodyJson(&t).Do()
@@ -194,6 +508,19 @@ func (e *elasticStore) RemoveAll() error {
 	return nil
 }
 
+// Flush will send all requests stored before the call,
+// and return when they have been acknowledged.
+// Any error that was encountered is returned.
+func (e *elasticStore) Flush() error {
+	done := make(chan struct{})
+	select {
+	case e.flush <- done:
+		<-done
+	case <-e.finished:
+	}
+	return e.err.Err()
+}
+
 // Close will flush the remaining stores and
 // return any errors that was encountered.
 func (e *elasticStore) Close() error {
@@ -2,8 +2,10 @@ package traffic
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
 	"os"
+	"reflect"
 	"testing"
 
 	"gopkg.in/olivere/elastic.v3"
@@ -120,3 +122,64 @@ func TestElastic(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// ackRecorder records all acknowledgements.
+type ackRecorder struct {
+	acks []Ack
+}
+
+func (a *ackRecorder) Ack(ack Ack) {
+	a.acks = append(a.acks, ack)
+}
+
+// Test that bulk responses are acknowledged per acker and document.
+func TestAckBulk(t *testing.T) {
+	a, b := &ackRecorder{}, &ackRecorder{}
+	batch := []*queued{
+		{seq: 1, id: "a1", acker: a},
+		{seq: 1, id: "b1", acker: b},
+		{seq: 2, id: "a2", acker: a},
+		{seq: 3, id: "none"},
+		{seq: 3, id: "a3", acker: a},
+	}
+	res := &elastic.BulkResponse{
+		Errors: true,
+		Items: []map[string]*elastic.BulkResponseItem{
+			{"index": {Id: "a1", Status: 201}},
+			{"index": {Id: "b1", Status: 201}},
+			{"index": {Id: "a2", Status: 400, Error: &elastic.ErrorDetails{Type: "mapper_parsing_exception", Reason: "failed to parse"}}},
+			{"index": {Id: "none", Status: 201}},
+			{"index": {Id: "a3", Status: 200}},
+		},
+	}
+	if n := ackBulk(batch, res, nil); n != 0 {
+		t.Fatalf("expected no failures without acker, got %d", n)
+	}
+	if len(a.acks) != 1 || len(b.acks) != 1 {
+		t.Fatalf("expected one ack per acker, got %d and %d", len(a.acks), len(b.acks))
+	}
+	got := a.acks[0]
+	if !reflect.DeepEqual(got.Stored, []int64{1, 3}) {
+		t.Fatalf("expected 1 and 3 to be stored, got %v", got.Stored)
+	}
+	want := []StoreFailure{{Seq: 2, ID: "a2", Reason: "mapper_parsing_exception: failed to parse"}}
+	if !reflect.DeepEqual(got.Failed, want) {
+		t.Fatalf("expected failures %v, got %v", want, got.Failed)
+	}
+	if !reflect.DeepEqual(b.acks[0].Stored, []int64{1}) {
+		t.Fatalf("expected 1 to be stored, got %v", b.acks[0].Stored)
+	}
+
+	// If the request failed, all documents have failed.
+	a = &ackRecorder{}
+	batch[0].acker = a
+	ackBulk(batch[:1], nil, errors.New("connection refused"))
+	want = []StoreFailure{{Seq: 1, ID: "a1", Reason: "connection refused"}}
+	if len(a.acks) != 1 || !reflect.DeepEqual(a.acks[0].Failed, want) {
+		t.Fatalf("expected failures %v, got %v", want, a.acks)
+	}
+	// Failures without acker are counted.
+	if n := ackBulk(batch[:4], nil, errors.New("connection refused")); n != 1 {
+		t.Fatalf("expected 1 failure without acker, got %d", n)
+	}
+}
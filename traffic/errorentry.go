@@ -0,0 +1,53 @@
+package traffic
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// ErrorIndex is the base name of the indexes of error log entries,
+// which are stored separately from requests.
+const ErrorIndex = "errors"
+
+// ErrorEntry contains information about a single line of
+// a web server error log.
+type ErrorEntry struct {
+	ID      string    `json:"_id,omitempty"`
+	Time    time.Time `json:"time"`             // Server local time of the entry
+	Level   string    `json:"level"`            // Severity, for example "error".
+	Module  string    `json:"module,omitempty"` // The module logging the entry, for example "core".
+	PID     int       `json:"pid,omitempty"`    // Process ID.
+	TID     int64     `json:"tid,omitempty"`    // Thread ID.
+	Client  string    `json:"client,omitempty"` // IP of the client of the request causing the entry.
+	Message string    `json:"message"`          // The logged message.
+}
+
+// GenerateHash will generate a unique hash for an entry
+// and populate the ID field of the entry.
+// As with requests, the hash is based on the JSON representation.
+func (e *ErrorEntry) GenerateHash() {
+	e.ID = ""
+	b, err := json.Marshal(e)
+	if err != nil {
+		panic(err)
+	}
+	hash := sha1.Sum(b)
+	e.ID = hex.EncodeToString(hash[:])
+}
+
+// Index returns an index based on a base name
+// combined with the UTC date, like Request.Index.
+func (e ErrorEntry) Index(base string) string {
+	suffix := e.Time.UTC().Format("2006.01.02")
+	return base + "-" + suffix
+}
+
+// ErrorStore is a store that can store error log entries
+// in addition to requests.
+type ErrorStore interface {
+	// StoreError stores an error log entry.
+	// If acker is not nil, the entry is acknowledged as with StoreAck.
+	StoreError(e ErrorEntry, seq int64, acker Acker) error
+}
@@ -0,0 +1,68 @@
+package traffic
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestErrorEntryHash(t *testing.T) {
+	e := ErrorEntry{Time: someTime, Level: "error", Module: "core", PID: 35708, TID: 4328636416, Client: "72.15.99.187", Message: "AH00124: File does not exist"}
+	e.GenerateHash()
+	id := e.ID
+	if len(id) != 40 {
+		t.Fatalf("expected sha1 hex ID, got %q", id)
+	}
+	// The ID is not part of the hash.
+	e.GenerateHash()
+	if e.ID != id {
+		t.Fatalf("hash changed from %q to %q", id, e.ID)
+	}
+	e.Message += "."
+	e.GenerateHash()
+	if e.ID == id {
+		t.Fatal("expected hash to change with the message")
+	}
+	if got := e.Index(ErrorIndex); got != "errors-2012.11.01" {
+		t.Fatalf("unexpected index %q", got)
+	}
+	e.Time = time.Date(2012, 11, 2, 1, 0, 0, 0, time.FixedZone("CET", 3600))
+	if got := e.Index(ErrorIndex); got != "errors-2012.11.02" {
+		t.Fatalf("unexpected index %q", got)
+	}
+}
+
+func TestJSONStoreError(t *testing.T) {
+	var buf bytes.Buffer
+	store, err := NewJSONStore(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := ErrorEntry{Time: someTime, Level: "warn", Message: "an upstream response is buffered"}
+	e.GenerateHash()
+	a := &ackRecorder{}
+	err = store.(ErrorStore).StoreError(e, 7, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.acks) != 1 || len(a.acks[0].Stored) != 1 || a.acks[0].Stored[0] != 7 {
+		t.Fatalf("expected line 7 to be acknowledged, got %+v", a.acks)
+	}
+	err = store.(ErrorStore).StoreError(e, 8, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []ErrorEntry
+	err = json.Unmarshal(buf.Bytes(), &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].ID != e.ID || got[0].Level != "warn" || got[0].Message != e.Message {
+		t.Fatalf("unexpected entries %+v", got)
+	}
+}
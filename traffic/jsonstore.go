@@ -4,11 +4,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"sync"
 )
 
 // jsonStore writes an array of requests to
 // the supplied writer
 type jsonStore struct {
+	mu     sync.Mutex
 	out    io.Writer
 	closed bool
 	queued []byte
@@ -16,7 +18,8 @@ type jsonStore struct {
 
 // NewJSONStore returns a RequestStore that writes an array of requests 
 // marshalled as JSON to the supplied writer.
-func NewJSONStore(out io.Writer) (RequestStore, error) {
+// The store can safely be used from multiple goroutines.
+func NewJSONStore(out io.Writer) (AckStore, error) {
 	j := &jsonStore{out: out}
 	fmt.Fprintln(j.out, "[")
 	return j, nil
@@ -26,24 +29,71 @@ func NewJSONStore(out io.Writer) (RequestStore, error) {
 // We keep one request, so we know if we should output a 
 // separating comma.
 func (j *jsonStore) Store(r Request) error {
+	return j.add(r)
+}
+
+// add will queue a value to be written to the array.
+func (j *jsonStore) add(v interface{}) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
 	if j.queued != nil {
 		fmt.Fprintln(j.out, "  " + string(j.queued) + ",")
 	}
 	var err error
-	j.queued, err = json.MarshalIndent(r, "  ", "  ")
+	j.queued, err = json.MarshalIndent(v, "  ", "  ")
 	return err
 }
 
 // Since we don't handle actual storage
 // this only clears any queued objects.  
 func (j *jsonStore) RemoveAll() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
 	j.queued = nil
 	return nil
 }
 
+// StoreAck will store a request and acknowledge it immediately if
+// acker is not nil, since there is no backend that can confirm it.
+func (j *jsonStore) StoreAck(r Request, seq int64, acker Acker) error {
+	err := j.Store(r)
+	if acker == nil {
+		return err
+	}
+	if err != nil {
+		acker.Ack(Ack{Failed: []StoreFailure{{Seq: seq, ID: r.ID, Reason: err.Error()}}})
+		return err
+	}
+	acker.Ack(Ack{Stored: []int64{seq}})
+	return nil
+}
+
+// StoreError will store an error log entry in the same array
+// as requests, and acknowledge it immediately if acker is not nil.
+func (j *jsonStore) StoreError(e ErrorEntry, seq int64, acker Acker) error {
+	err := j.add(e)
+	if acker == nil {
+		return err
+	}
+	if err != nil {
+		acker.Ack(Ack{Failed: []StoreFailure{{Seq: seq, ID: e.ID, Reason: err.Error()}}})
+		return err
+	}
+	acker.Ack(Ack{Stored: []int64{seq}})
+	return nil
+}
+
+// Flush does nothing, since requests are acknowledged
+// when they are stored.
+func (j *jsonStore) Flush() error {
+	return nil
+}
+
 // Close will flush the remaining queue
 // and close the array.
 func (j *jsonStore) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
 	if j.queued != nil {
 		fmt.Fprintln(j.out, "  "+ string(j.queued))
 		j.queued = nil
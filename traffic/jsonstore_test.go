@@ -81,3 +81,20 @@ func TestJSONStore(t *testing.T) {
      t.Fatal("JSON did not match reference")
   }
 }
+
+// Tests that requests can be stored without an acker.
+func TestJSONStoreAckNil(t *testing.T) {
+	var buf bytes.Buffer
+	store, err := NewJSONStore(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.StoreAck(storeTests[0], 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
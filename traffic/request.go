@@ -26,6 +26,34 @@ type Request struct {
 	StatusCode int       `json:"status"`       // The status code returned
 	Payload    int       `json:"payload_size"` // The size of the returned body in bytes
 
+	// Optional fields.
+	// These are omitted when empty, so the hash of requests without them is unchanged.
+	RemoteUser     string     `json:"remote_user,omitempty"`            // Authenticated user.
+	Referer        string     `json:"referer,omitempty"`                // The Referer header.
+	UserAgent      string     `json:"user_agent,omitempty"`             // The User-Agent header.
+	VirtualHost    string     `json:"vhost,omitempty"`                  // The virtual host serving the request.
+	RequestTime    float64    `json:"request_time,omitempty"`           // Time taken to serve the request in seconds.
+	UpstreamTime   float64    `json:"upstream_response_time,omitempty"` // Time spent waiting for upstream servers in seconds.
+	UpstreamAddr   string     `json:"upstream_addr,omitempty"`          // Address of the upstream servers, separated by commas.
+	ForwardedFor   string     `json:"forwarded_for,omitempty"`          // The X-Forwarded-For header.
+	RequestID      string     `json:"request_id,omitempty"`             // Unique ID of the request.
+	Malformed      bool       `json:"malformed_request,omitempty"`      // The request line could not be parsed.
+	UpstreamStatus int        `json:"upstream_status,omitempty"`        // Status returned by the upstream server.
+	TLSProtocol    string     `json:"ssl_protocol,omitempty"`           // TLS protocol of the connection.
+	TLSCipher      string     `json:"ssl_cipher,omitempty"`             // TLS cipher of the connection.
+	EdgeLocation   string     `json:"edge_location,omitempty"`          // CDN edge location serving the request.
+	Frontend       string     `json:"frontend,omitempty"`               // Proxy frontend receiving the request.
+	Backend        string     `json:"backend,omitempty"`                // Proxy backend or cluster handling the request.
+	Server         string     `json:"server,omitempty"`                 // Name of the backend server handling the request.
+	ResponseFlags  []string   `json:"response_flags,omitempty"`         // Envoy response flags, for example "UH".
+	CacheResult    string     `json:"cache_result,omitempty"`           // Cache result of a proxy, for example "TCP_MISS".
+	Hierarchy      string     `json:"hierarchy,omitempty"`              // How a proxy forwarded the request, for example "HIER_DIRECT".
+	DestHost       string     `json:"dest_host,omitempty"`              // Destination host of a forward proxy request.
+	HAProxy        *HAProxy   `json:"haproxy,omitempty"`                // HAProxy timers and connection counts.
+	Container      *Container `json:"container,omitempty"`              // The container writing the log.
+	SyslogHost     string     `json:"syslog_host,omitempty"`            // Host of the syslog message carrying the request.
+	SyslogApp      string     `json:"syslog_app,omitempty"`             // App of the syslog message carrying the request.
+
 	// Enriched fields:
 	HourOfDay  int                `json:"hour_of_day"`           // Hour of day of server time (in UTC).
 	RemoteIP   string             `json:"remote_ip,omitempty"`   // IP of the requester
@@ -109,6 +137,34 @@ func (r Request) Index(base string) string {
 	return base + "-" + suffix
 }
 
+// HAProxy contains the fields of HAProxy HTTP logs,
+// that have no equivalent in other logs.
+// Times are in milliseconds, and -1 if the step was not reached.
+type HAProxy struct {
+	TerminationState string `json:"termination_state"` // Session state at disconnection, for example "----".
+	RequestTime      int    `json:"request_ms"`        // TR: Time to receive the request headers.
+	QueueTime        int    `json:"queue_ms"`          // Tw: Time spent in queues.
+	ConnectTime      int    `json:"connect_ms"`        // Tc: Time to connect to the server.
+	ResponseTime     int    `json:"response_ms"`       // Tr: Time for the server to send the response headers.
+	ActiveTime       int    `json:"active_ms"`         // Ta: Total active time of the request.
+	ActiveConns      int    `json:"actconn"`           // Concurrent connections on the process.
+	FrontendConns    int    `json:"feconn"`            // Concurrent connections on the frontend.
+	BackendConns     int    `json:"beconn"`            // Concurrent connections on the backend.
+	ServerConns      int    `json:"srv_conn"`          // Concurrent connections on the server.
+	Retries          int    `json:"retries"`           // Connection retries.
+	ServerQueue      int    `json:"srv_queue"`         // Requests queued before this one on the server.
+	BackendQueue     int    `json:"backend_queue"`     // Requests queued before this one on the backend.
+}
+
+// Container identifies the container that wrote a log line.
+// Fields are empty if they are not known.
+type Container struct {
+	Namespace string `json:"namespace,omitempty"` // Kubernetes namespace.
+	Pod       string `json:"pod,omitempty"`       // Kubernetes pod.
+	Name      string `json:"name,omitempty"`      // Container name.
+	ID        string `json:"id,omitempty"`        // Container ID.
+}
+
 // RequestStore indicates an interface that can be used
 // to store requests.
 type RequestStore interface {
@@ -127,3 +183,40 @@ type RequestStore interface {
 	// requests when the function returns.
 	Close() error
 }
+
+// AckStore is a RequestStore that acknowledges which requests
+// have been stored in the backend.
+type AckStore interface {
+	RequestStore
+
+	// StoreAck stores a request with a sequence number assigned by the caller.
+	// When the batch containing the request has been processed, Ack is
+	// called on the acker with the result of all requests in the batch
+	// that was stored with the same acker.
+	// Ack may be called before StoreAck returns, and from another goroutine.
+	StoreAck(r Request, seq int64, acker Acker) error
+
+	// Flush must not return before all requests stored before
+	// the call have been acknowledged.
+	// Any error encountered by the store is returned.
+	Flush() error
+}
+
+// Acker receives acknowledgements from an AckStore.
+type Acker interface {
+	Ack(Ack)
+}
+
+// Ack contains the result of the requests in a batch.
+// Sequence numbers are in the order the requests were stored.
+type Ack struct {
+	Stored []int64        // Sequence numbers of the requests that were stored.
+	Failed []StoreFailure // Requests that were not stored.
+}
+
+// StoreFailure describes a request that could not be stored.
+type StoreFailure struct {
+	Seq    int64  // Sequence number of the request.
+	ID     string // ID of the request.
+	Reason string // The reason given by the backend.
+}